@@ -0,0 +1,224 @@
+package webapp
+
+/**
+ * Access logging for every request passing through DefaultServer, both
+ * registered routes and static files. Lines are written in Common or
+ * Combined Log Format, or as JSON objects, one per line.
+ */
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Settings are described in help.go
+type AccessLogConfig struct {
+	Format string `json:"format" xml:"format" toml:"format" reload:"no"`
+	Output string `json:"output" xml:"output" toml:"output" reload:"no" default:"stderr"`
+	SampleRate float64 `json:"samplerate" xml:"samplerate" toml:"samplerate"`
+}//-- end AccessLogConfig struct
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+func (cfg *AccessLogConfig) Validate () error {
+	switch (strings.ToLower(cfg.Format)) {
+		case "", "common", "combined", "json":
+		default:
+			return fmt.Errorf(`Invalid access log format "%s"`, cfg.Format)
+	}//-- end switch
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return errors.New("AccessLog.SampleRate must be between 0 and 1")
+	}
+	return nil
+}//-- end func AccessLogConfig.Validate
+
+func openAccessLog (output string) (io.Writer, error) {
+	switch (output) {
+		case "", "stderr":
+			return os.Stderr, nil
+		case "stdout":
+			return os.Stdout, nil
+		default:
+			return os.OpenFile(output, os.O_WRONLY | os.O_APPEND | os.O_CREATE,
+				0644)
+	}//-- end switch
+}//-- end func openAccessLog
+
+type requestIDKey struct{}
+
+// Returns the ID assigned to the request by the access log, taken from
+// the client's X-Request-Id header when present.
+func RequestID (r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}//-- end func RequestID
+
+func newRequestID () string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}//-- end func newRequestID
+
+// Records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes int64
+}//-- end statusWriter struct
+
+func (sw *statusWriter) WriteHeader (status int) {
+	if sw.status == 0 { sw.status = status }
+	sw.ResponseWriter.WriteHeader(status)
+}//-- end func statusWriter.WriteHeader
+
+func (sw *statusWriter) Write (b []byte) (int, error) {
+	if sw.status == 0 { sw.status = http.StatusOK }
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}//-- end func statusWriter.Write
+
+func (sw *statusWriter) Flush () {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok { flusher.Flush() }
+}//-- end func statusWriter.Flush
+
+func (sw *statusWriter) Hijack () (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := sw.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("ResponseWriter does not support Hijack")
+}//-- end func statusWriter.Hijack
+
+func (sw *statusWriter) Unwrap () http.ResponseWriter {
+	return sw.ResponseWriter
+}//-- end func statusWriter.Unwrap
+
+type accessEntry struct {
+	Time time.Time `json:"time"`
+	Remote string `json:"remote"`
+	User string `json:"user,omitempty"`
+	Method string `json:"method"`
+	Path string `json:"path"`//-- escaped, as the client sent it
+	Query string `json:"query,omitempty"`
+	Proto string `json:"proto"`
+	Status int `json:"status"`
+	Bytes int64 `json:"bytes"`
+	LatencyMs float64 `json:"latency_ms"`
+	RequestID string `json:"request_id"`
+	Referer string `json:"referer,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}//-- end accessEntry struct
+
+func dashIfEmpty (s string) string {
+	if s == "" { return "-" }
+	return s
+}//-- end func dashIfEmpty
+
+// Escapes quotes, backslashes and control characters as \" and \xhh, as
+// Apache does, so that a client cannot end a field or forge a line
+func clfEscape (s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+			case c == '"' || c == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c < 0x20 || c == 0x7f:
+				fmt.Fprintf(&buf, "\\x%02x", c)
+			default:
+				buf.WriteByte(c)
+		}//-- end switch
+	}//-- end for range s
+	return buf.String()
+}//-- end func clfEscape
+
+func (entry *accessEntry) clf () string {
+	host := entry.Remote
+	if h, _, err := net.SplitHostPort(host); err == nil { host = h }
+	uri := entry.Path
+	if entry.Query != "" { uri += "?" + entry.Query }
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d`, clfEscape(host),
+		clfEscape(dashIfEmpty(entry.User)), entry.Time.Format(clfTimeFormat),
+		clfEscape(entry.Method), clfEscape(uri), clfEscape(entry.Proto),
+		entry.Status, entry.Bytes)
+}//-- end func accessEntry.clf
+
+type accessLogger struct {
+	format string
+	sampleRate uint64//-- float64 bits, accessed atomically
+	out io.Writer
+	mut sync.Mutex
+}//-- end accessLogger struct
+
+func newAccessLogger (cfg *AccessLogConfig) (*accessLogger, error) {
+	out, err := openAccessLog(cfg.Output)
+	if err != nil { return nil, err }
+	al := &accessLogger{format: strings.ToLower(cfg.Format), out: out}
+	al.setSampleRate(cfg.SampleRate)
+	return al, nil
+}//-- end func newAccessLogger
+
+func (al *accessLogger) setSampleRate (rate float64) {
+	atomic.StoreUint64(&al.sampleRate, math.Float64bits(rate))
+}//-- end func accessLogger.setSampleRate
+
+func (al *accessLogger) sampled (status int) bool {
+	rate := math.Float64frombits(atomic.LoadUint64(&al.sampleRate))
+	if status >= 500 || rate <= 0 || rate >= 1 { return true }
+	return mrand.Float64() < rate
+}//-- end func accessLogger.sampled
+
+func (al *accessLogger) write (entry *accessEntry) {
+	var line string
+	switch (al.format) {
+		case "json":
+			encoded, _ := json.Marshal(entry)
+			line = string(encoded)
+		case "combined":
+			line = fmt.Sprintf(`%s "%s" "%s"`, entry.clf(),
+				clfEscape(dashIfEmpty(entry.Referer)),
+				clfEscape(dashIfEmpty(entry.UserAgent)))
+		default:
+			line = entry.clf()
+	}//-- end switch
+	al.mut.Lock()
+	defer al.mut.Unlock()
+	io.WriteString(al.out, line + "\n")
+}//-- end func accessLogger.write
+
+func makeAccessLogHandler (next http.Handler,
+		al *accessLogger) http.HandlerFunc {
+	return func (w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > 128 { id = newRequestID() }
+		w.Header().Set("X-Request-Id", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 { sw.status = http.StatusOK }
+		if !al.sampled(sw.status) { return }
+		user, _, _ := r.BasicAuth()
+		if user == "" && r.URL.User != nil { user = r.URL.User.Username() }
+		al.write(&accessEntry{Time: start, Remote: r.RemoteAddr, User: user,
+			Method: r.Method, Path: r.URL.EscapedPath(), Query: r.URL.RawQuery,
+			Proto: r.Proto, Status: sw.status, Bytes: sw.bytes,
+			LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+			RequestID: id, Referer: r.Referer(), UserAgent: r.UserAgent()})
+	}//-- end return
+}//-- end func makeAccessLogHandler
@@ -0,0 +1,76 @@
+package webapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogFormats (t *testing.T) {
+	handler := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		if RequestID(r) == "" { t.Error("no request ID in context") }
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+	for _, test := range []struct{ format, want string }{
+		{"common", `1.2.3.4 - a\"b [`},
+		{"common", `"GET /a%0A1.2.3.4%20-%20-%20%22x/b?q=1 HTTP/1.1" 418 15`},
+		{"combined", `418 15 "-" "agent \"x\"\x0a"`}} {
+		var out bytes.Buffer
+		al := &accessLogger{format: test.format, out: &out}
+		req := httptest.NewRequest("GET",
+			"/a%0A1.2.3.4%20-%20-%20%22x/b?q=1", nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		req.SetBasicAuth("a\"b", "pw")
+		req.Header.Set("User-Agent", "agent \"x\"\n")
+		rec := httptest.NewRecorder()
+		makeAccessLogHandler(handler, al)(rec, req)
+		line := out.String()
+		if !strings.Contains(line, test.want) ||
+				strings.Count(line, "\n") != 1 {
+			t.Errorf("%s: got %q, want it to hold %q", test.format, line,
+				test.want)
+		}
+	}//-- end for range tests
+	var out bytes.Buffer
+	al := &accessLogger{format: "json", out: &out}
+	req := httptest.NewRequest("GET", "/x?y=z", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	rec := httptest.NewRecorder()
+	makeAccessLogHandler(handler, al)(rec, req)
+	var entry accessEntry
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil { t.Fatal(err) }
+	if entry.Path != "/x" || entry.Query != "y=z" || entry.Status != 418 ||
+			entry.Bytes != 15 || entry.RequestID != "abc" ||
+			rec.Header().Get("X-Request-Id") != "abc" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}//-- end TestAccessLogFormats
+
+func TestAccessLogSampling (t *testing.T) {
+	output := filepath.Join(t.TempDir(), "access.log")
+	al, err := newAccessLogger(&AccessLogConfig{Format: "COMMON",
+		Output: output, SampleRate: 0.5})
+	if err != nil { t.Fatal(err) }
+	if al.format != "common" { t.Errorf("format %s not lowercased", al.format) }
+	logged := 0
+	for i := 0; i < 1000; i++ {
+		if al.sampled(http.StatusOK) { logged++ }
+		if !al.sampled(http.StatusBadGateway) {
+			t.Fatal("server error not logged")
+		}
+	}//-- end for
+	if logged < 350 || logged > 650 {
+		t.Errorf("logged %d of 1000 at rate 0.5", logged)
+	}
+	al.setSampleRate(0)
+	if !al.sampled(http.StatusOK) { t.Error("rate 0 should log everything") }
+	if _, err = newAccessLogger(&AccessLogConfig{
+			Output: filepath.Join(output, "nested")}); err == nil {
+		t.Error("unopenable output accepted")
+	}
+}//-- end TestAccessLogSampling
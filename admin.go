@@ -0,0 +1,194 @@
+package webapp
+
+/**
+ * Optional admin listener, bound to ServerConfig.AdminPort. Serves
+ * profiling and runtime controls on their own mux, so that nothing here
+ * is ever reachable through the public Handler. Note that net/http/pprof
+ * and expvar are deliberately not imported: both register themselves on
+ * http.DefaultServeMux, which applications may be using publicly.
+ * /debug/vars is served here instead, in the same shape as expvar's.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const adminIndex = `admin endpoints:
+  /debug/pprof/       profiles (runtime/pprof)
+  /debug/vars         runtime and server variables, as JSON
+  /routes             registered routes
+  /loglevel           GET current level; POST level=debug|info|warn|error
+  /static/reload      POST to reload the static file cache
+`
+
+var (
+	adminVars = make(map[string]func() interface{})
+	adminVarsMut sync.Mutex
+)
+
+// Publishes a variable to the admin listener's /debug/vars. Names are
+// shared by every server in the process: if several publish the same
+// name, the last one's value is shown.
+func publishVar (name string, value func() interface{}) {
+	adminVarsMut.Lock()
+	defer adminVarsMut.Unlock()
+	adminVars[name] = value
+}//-- end func publishVar
+
+func (svr *DefaultServer) makeAdminHandler () http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func (w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, adminIndex)
+	})
+	mux.HandleFunc("/debug/pprof/", serveAdminPprof)
+	mux.HandleFunc("/debug/vars", serveAdminVars)
+	mux.HandleFunc("/routes", svr.serveAdminRoutes)
+	mux.HandleFunc("/loglevel", serveAdminLogLevel)
+	mux.HandleFunc("/static/reload", svr.serveAdminReload)
+	return mux
+}//-- end func DefaultServer.makeAdminHandler
+
+func requirePost (w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		return true
+	}
+	w.Header().Set("Allow", "POST, PUT")
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}//-- end func requirePost
+
+func adminSeconds (r *http.Request, defaultSecs int) time.Duration {
+	secs, err := strconv.Atoi(r.FormValue("seconds"))
+	if err != nil || secs <= 0 { secs = defaultSecs }
+	return time.Duration(secs) * time.Second
+}//-- end func adminSeconds
+
+// Blocks for the given duration, or until the client goes away.
+func sleepRequest (r *http.Request, dur time.Duration) {
+	select {
+		case <-time.After(dur):
+		case <-r.Context().Done():
+	}//-- end select
+}//-- end func sleepRequest
+
+func serveAdminPprof (w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	switch (name) {
+		case "":
+			profiles := pprof.Profiles()
+			sort.Slice(profiles, func (i, j int) bool {
+				return profiles[i].Name() < profiles[j].Name()
+			})
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			for _, prof := range profiles {
+				fmt.Fprintf(w, "%d\t%s\n", prof.Count(), prof.Name())
+			}
+			fmt.Fprint(w, "-\tprofile\n-\ttrace\n-\tcmdline\n")
+		case "cmdline":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+		case "profile":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			if err := pprof.StartCPUProfile(w); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			sleepRequest(r, adminSeconds(r, 30))
+			pprof.StopCPUProfile()
+		case "trace":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			if err := trace.Start(w); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			sleepRequest(r, adminSeconds(r, 1))
+			trace.Stop()
+		default:
+			prof := pprof.Lookup(name)
+			if prof == nil {
+				http.NotFound(w, r)
+				return
+			}
+			debug, _ := strconv.Atoi(r.FormValue("debug"))
+			if name == "heap" && r.FormValue("gc") != "" { runtime.GC() }
+			if debug == 0 {
+				w.Header().Set("Content-Type", "application/octet-stream")
+			} else {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			}
+			prof.WriteTo(w, debug)
+	}//-- end switch
+}//-- end func serveAdminPprof
+
+// Writes variables in the same shape as expvar's /debug/vars.
+func serveAdminVars (w http.ResponseWriter, _ *http.Request) {
+	memstats := new(runtime.MemStats)
+	runtime.ReadMemStats(memstats)
+	vars := map[string]interface{}{
+		"cmdline": os.Args,
+		"memstats": memstats,
+		"goroutines": runtime.NumGoroutine()}
+	adminVarsMut.Lock()
+	published := make(map[string]func() interface{}, len(adminVars))
+	for name, value := range adminVars { published[name] = value }
+	adminVarsMut.Unlock()
+	for name, value := range published { vars[name] = value() }
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(vars)
+}//-- end func serveAdminVars
+
+func (svr *DefaultServer) serveAdminRoutes (w http.ResponseWriter,
+		_ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if svr.routes == nil {
+		fmt.Fprintln(w, "route listing not supported by Handler")
+		return
+	}
+	for _, path := range svr.routes() { fmt.Fprintln(w, path) }
+}//-- end func DefaultServer.serveAdminRoutes
+
+func serveAdminLogLevel (w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if !requirePost(w, r) { return }
+		lvl, err := ParseLogLevel(r.FormValue("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		SetLogLevel(lvl)
+		logf(LogInfo, "admin: log level set to %s\n", lvl)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, GetLogLevel())
+}//-- end func serveAdminLogLevel
+
+func (svr *DefaultServer) serveAdminReload (w http.ResponseWriter,
+		r *http.Request) {
+	if !requirePost(w, r) { return }
+	count, err := svr.ReloadStatic()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logf(LogInfo, "admin: reloaded %d static files\n", count)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "reloaded %d static files\n", count)
+}//-- end func DefaultServer.serveAdminReload
@@ -0,0 +1,80 @@
+package webapp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAdminHandler (t *testing.T) {
+	cfg := &ServerConfig{Port: ":0", AdminPort: "127.0.0.1:0",
+		StaticFS: fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}}
+	svr := new(DefaultServer)
+	table := &routeTable{Handler: http.NewServeMux()}
+	table.HandleFunc("/api/users",
+		func (http.ResponseWriter, *http.Request) {})
+	if err := svr.Init(cfg, table); err != nil { t.Fatal(err) }
+	publishVar("admin_test_app", func() interface{} { return "published" })
+	admin := svr.makeAdminHandler()
+	serve := func (method, target string,
+			form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target,
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		return rec
+	}//-- end func serve
+	rec := serve("GET", "/debug/vars", nil)
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"memstats", "cmdline", "goroutines",
+			"server", "static", "admin_test_app"} {
+		if vars[name] == nil { t.Errorf("/debug/vars lacks %s", name) }
+	}
+	if rec = serve("GET", "/routes", nil);
+			!strings.Contains(rec.Body.String(), "/api/users") {
+		t.Errorf("routes: got %q", rec.Body.String())
+	}
+	if rec = serve("GET", "/debug/pprof/", nil);
+			!strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("pprof index: got %q", rec.Body.String())
+	}
+	if rec = serve("GET", "/debug/pprof/nonesuch", nil); rec.Code != 404 {
+		t.Errorf("unknown profile: got %d", rec.Code)
+	}
+	level := GetLogLevel()
+	defer SetLogLevel(level)
+	rec = serve("POST", "/loglevel", url.Values{"level": {"debug"}})
+	if rec.Code != http.StatusOK || GetLogLevel() != LogDebug {
+		t.Errorf("loglevel: got %d, level %s", rec.Code, GetLogLevel())
+	}
+	rec = serve("POST", "/loglevel", url.Values{"level": {"loud"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("bad level: got %d", rec.Code)
+	}
+	if rec = serve("GET", "/static/reload", nil);
+			rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET reload: got %d", rec.Code)
+	}
+	rec = serve("POST", "/static/reload", nil)
+	if rec.Code != http.StatusOK ||
+			rec.Body.String() != "reloaded 1 static files\n" {
+		t.Errorf("reload: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec = serve("GET", "/nonesuch", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown path: got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest("GET",
+		"/debug/vars", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/debug/vars served publicly: got %d", rec.Code)
+	}
+}//-- end TestAdminHandler
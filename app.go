@@ -12,8 +12,12 @@ import (
 	"strings"
 	"net/http"
 	"context"
+	"html/template"
+	"sort"
+	"sync"
 	"time"
 	"gopkg.in/ollykel/webapp.v0/model"
+	"gopkg.in/ollykel/webapp.v0/resp"
 )
 
 /** see config.go for related funcs
@@ -21,6 +25,7 @@ type Config struct {
 	Index string
 	StaticDir string
 	WaitSecs int
+	LogLevel string//-- see log.go
 	Server ServerConfig//-- see server.go
 	Database DatabaseConfig//-- see database.go
 }
@@ -32,6 +37,29 @@ type Handler interface {
 		r *http.Request))
 }//-- end Handler interface
 
+// Wraps a Handler to keep track of the paths registered on it
+type routeTable struct {
+	Handler
+	paths []string
+	mut sync.Mutex
+}//-- end routeTable struct
+
+func (rt *routeTable) HandleFunc (path string,
+		handler func(w http.ResponseWriter, r *http.Request)) {
+	rt.mut.Lock()
+	rt.paths = append(rt.paths, path)
+	rt.mut.Unlock()
+	rt.Handler.HandleFunc(path, handler)
+}//-- end func routeTable.HandleFunc
+
+func (rt *routeTable) Routes () []string {
+	rt.mut.Lock()
+	defer rt.mut.Unlock()
+	paths := append([]string(nil), rt.paths...)
+	sort.Strings(paths)
+	return paths
+}//-- end func routeTable.Routes
+
 type Webapp struct {
 	server Server
 	handler Handler//-- will go into server
@@ -148,6 +176,30 @@ func (app *Webapp) RegisterModels (mods []*model.Definition) (err error) {
 	return
 }//-- end Webapp.RegisterModels
 
+func (app *Webapp) Routes () []string {
+	table, ok := app.handler.(*routeTable)
+	if !ok { return nil }
+	return table.Routes()
+}//-- end func Webapp.Routes
+
+// Returns the URL to reference a static file by: its fingerprinted path,
+// if the server fingerprints assets (see fingerprint.go).
+func (app *Webapp) AssetPath (urlPath string) string {
+	if assets, ok := app.server.(interface{ AssetPath (string) string }); ok {
+		return assets.AssetPath(urlPath)
+	}
+	return urlPath
+}//-- end func Webapp.AssetPath
+
+// Functions for templates rendered by the app, e.g. through
+// wapputils.CacheFileServerFuncs: {{asset "/js/app.js"}}, and
+// {{cspNonce}} for the nonce attribute of inline scripts (replaced with
+// each request's nonce as the page is served; see security.go)
+func (app *Webapp) TemplateFuncs () template.FuncMap {
+	return template.FuncMap{"asset": app.AssetPath,
+		"cspNonce": func () string { return resp.NoncePlaceholder }}
+}//-- end func Webapp.TemplateFuncs
+
 func (app *Webapp) ListenAndServe() error {
 	log.Printf("Server listening at %s...\n", app.server.GetAddr())
 	return app.server.Serve()
@@ -163,14 +215,20 @@ func Init (config *Config, svr Server, handler Handler,
 		log.Printf("Waiting %d seconds...", config.WaitSecs)
 		time.Sleep(time.Duration(config.WaitSecs) * time.Second)
 	}
+	if config.LogLevel != "" {
+		lvl, err := ParseLogLevel(config.LogLevel)
+		if err != nil { return nil, err }
+		SetLogLevel(lvl)
+	}
 	app = new(Webapp)
 	app.db = db
 	err = db.Init(&config.Database)
 	if err != nil { return nil, err }
 	log.Print("Database reached successfully")
 	app.middleware = make([]Middleware, 0)
-	app.handler = handler
-	err = svr.Init(&config.Server, app.handler)
+	app.handler = &routeTable{Handler: handler}
+	serverCfg := config.serverConfig()//-- leaves config unmodified
+	err = svr.Init(&serverCfg, app.handler)
 	if err != nil { return nil, err }
 	log.Print("Server initialized successfully")
 	app.handler.HandleFunc("/", svr.ServeStatic)
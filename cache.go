@@ -0,0 +1,116 @@
+package webapp
+
+/**
+ * Memory budget for the static file cache. Files larger than the
+ * stream threshold are never held in memory and are served straight
+ * from disk; the rest are kept resident up to a total byte budget,
+ * beyond which the least recently served are evicted and re-read from
+ * disk on their next request. Files changed on disk in the meantime are
+ * not served until reloaded, lest new content go out under old
+ * validators.
+ */
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot of static cache metrics, as returned by
+// DefaultServer.StaticStats
+type StaticCacheStats struct {
+	Files int
+	ResidentFiles int
+	ResidentBytes int64
+	Hits, Misses, Evictions, Streamed uint64
+}//-- end StaticCacheStats struct
+
+type staticCache struct {
+	streamThreshold int64//-- zero never streams
+	maxBytes int64//-- zero is unbounded
+	resident *list.List//-- of *staticFile, most recently used first
+	residentBytes int64
+	hits, misses, evictions, streamed uint64
+	mut sync.Mutex
+}//-- end staticCache struct
+
+func newStaticCache (streamThreshold, maxBytes int64) *staticCache {
+	return &staticCache{streamThreshold: streamThreshold,
+		maxBytes: maxBytes, resident: list.New()}
+}//-- end func newStaticCache
+
+// Reports whether a file of the given size should be served from disk
+func (cache *staticCache) streams (size int64) bool {
+	if cache == nil { return false }
+	return (cache.streamThreshold > 0 && size > cache.streamThreshold) ||
+		(cache.maxBytes > 0 && size > cache.maxBytes)
+}//-- end func staticCache.streams
+
+// Makes content resident for file, evicting others to stay in budget.
+func (cache *staticCache) insert (file *staticFile, content []byte) {
+	cache.mut.Lock()
+	defer cache.mut.Unlock()
+	if file.elem != nil { return }//-- loaded concurrently
+	file.content = content
+	file.elem = cache.resident.PushFront(file)
+	cache.residentBytes += int64(len(content))
+	for cache.maxBytes > 0 && cache.residentBytes > cache.maxBytes {
+		oldest := cache.resident.Back()
+		if oldest == nil || oldest == file.elem { break }
+		cache.evict(oldest.Value.(*staticFile))
+		cache.evictions++
+	}//-- end for
+}//-- end func staticCache.insert
+
+// Drops file's content; caller must hold mut.
+func (cache *staticCache) evict (file *staticFile) {
+	if file.elem == nil { return }
+	cache.resident.Remove(file.elem)
+	cache.residentBytes -= int64(len(file.content))
+	file.elem, file.content = nil, nil
+}//-- end func staticCache.evict
+
+// Releases files no longer in the map.
+func (cache *staticCache) forget (files ...*staticFile) {
+	if cache == nil { return }
+	cache.mut.Lock()
+	defer cache.mut.Unlock()
+	for _, file := range files { cache.evict(file) }
+}//-- end func staticCache.forget
+
+// Returns file's content, reading it back from disk if evicted. Content
+// changed on disk since the file was loaded is an error, rather than
+// served under the old ETag; the next refresh, if any, reloads it.
+func (cache *staticCache) content (file *staticFile) ([]byte, error) {
+	if cache == nil { return file.content, nil }
+	cache.mut.Lock()
+	if file.elem != nil {
+		cache.resident.MoveToFront(file.elem)
+		content := file.content
+		cache.mut.Unlock()
+		atomic.AddUint64(&cache.hits, 1)
+		return content, nil
+	}
+	cache.mut.Unlock()
+	atomic.AddUint64(&cache.misses, 1)
+	content, err := fs.ReadFile(file.fsys, file.path)
+	if err != nil { return nil, err }
+	if contentETag(content) != file.etag {
+		return nil, fmt.Errorf("%s: changed on disk since loaded", file.path)
+	}
+	cache.insert(file, content)
+	return content, nil
+}//-- end func staticCache.content
+
+func (cache *staticCache) stats () StaticCacheStats {
+	cache.mut.Lock()
+	defer cache.mut.Unlock()
+	return StaticCacheStats{ResidentFiles: cache.resident.Len(),
+		ResidentBytes: cache.residentBytes,
+		Hits: atomic.LoadUint64(&cache.hits),
+		Misses: atomic.LoadUint64(&cache.misses),
+		Evictions: cache.evictions,
+		Streamed: atomic.LoadUint64(&cache.streamed)}
+}//-- end func staticCache.stats
@@ -2,55 +2,180 @@ package webapp
 
 import (
 	"os"
+	"io"
+	"io/ioutil"
 	"fmt"
+	"bytes"
+	"errors"
+	"reflect"
 	"strings"
 	"encoding/json"
-	"encoding/xml"
 	// imported packages
 	yaml "gopkg.in/yaml.v2"
 )
 
+// Settings are described in help.go
 type Config struct {
-	Index string
-	StaticDir string
-	WaitSecs int
-	Server ServerConfig//-- see server.go
-	Database DatabaseConfig//-- see database.go
+	Index string `json:"index" xml:"index" toml:"index" default:"index.html"`
+	StaticDir string `json:"staticdir" xml:"staticdir" toml:"staticdir" reload:"no"`
+	WaitSecs int `json:"waitsecs" xml:"waitsecs" toml:"waitsecs"`
+	// see log.go
+	LogLevel string `json:"loglevel" xml:"loglevel" toml:"loglevel" default:"info"`
+	// see server.go
+	Server ServerConfig `json:"server" xml:"server" toml:"server"`
+	// see database.go
+	Database DatabaseConfig `json:"database" xml:"database" toml:"database" reload:"no"`
+	sections map[string]reflect.Value//-- see sections.go
 }
 
+// Secret fields are redacted; see secrets.go
 func (cfg *Config) String () string {
-	output, _ := json.Marshal(cfg)
+	output, _ := json.Marshal(cfg.Redacted().encodable())
 	return string(output)
 }//-- end Config.String
 
+// Every problem found in a configuration, rather than just the first
+type ConfigErrors []error
+
+// Appends err, if any, flattening nested ConfigErrors
+func (errs *ConfigErrors) Add (err error) {
+	if nested, ok := err.(ConfigErrors); ok {
+		*errs = append(*errs, nested...)
+	} else if err != nil {
+		*errs = append(*errs, err)
+	}
+}//-- end func ConfigErrors.Add
+
+// Returns errs as an error, or nil if it is empty
+func (errs ConfigErrors) Err () error {
+	if len(errs) == 0 { return nil }
+	return errs
+}//-- end func ConfigErrors.Err
+
+func (errs ConfigErrors) Error () string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs { msgs[i] = err.Error() }
+	return strings.Join(msgs, "; ")
+}//-- end func ConfigErrors.Error
+
 type decoder interface {
 	Decode (interface{}) error
 }//-- end Decoder interface
 
-func getDecoder (file *os.File, fileExt string) (decoder, error) {
-	switch (fileExt) {
+// Decodes JSON, reporting errors by line
+type jsonDecoder struct {
+	content []byte
+	strict bool
+}//-- end jsonDecoder struct
+
+func (dec *jsonDecoder) Decode (v interface{}) error {
+	jsonDec := json.NewDecoder(bytes.NewReader(dec.content))
+	if dec.strict { jsonDec.DisallowUnknownFields() }
+	err := jsonDec.Decode(v)
+	if err == nil || err == io.EOF { return err }
+	offset := jsonDec.InputOffset()
+	switch e := err.(type) {
+		case *json.SyntaxError:
+			offset = e.Offset
+		case *json.UnmarshalTypeError:
+			offset = e.Offset
+	}//-- end switch
+	line := 1 + bytes.Count(dec.content[:offset], []byte("\n"))
+	return fmt.Errorf("line %d: %s", line, err.Error())
+}//-- end func jsonDecoder.Decode
+
+// Returns a decoder for the given format (see formats.go), sniffing it
+// from the content if empty. If strict is set, keys matching no field
+// are errors; XML and HCL have no strict mode, and ignore them regardless.
+func getDecoder (file io.Reader, format string, strict bool) (decoder,
+		error) {
+	if format == "" {
+		content, err := ioutil.ReadAll(file)
+		if err != nil { return nil, err }
+		format, file = sniffFormat(content), bytes.NewReader(content)
+	}
+	switch (format) {
 		case "json":
-			return json.NewDecoder(file), nil
+			content, err := ioutil.ReadAll(file)
+			if err != nil { return nil, err }
+			return &jsonDecoder{content: content, strict: strict}, nil
 		case "xml":
-			return xml.NewDecoder(file), nil
+			content, err := ioutil.ReadAll(file)
+			if err != nil { return nil, err }
+			return &xmlDecoder{content: content}, nil
 		case "yaml", "yml":
-			return yaml.NewDecoder(file), nil
+			dec := yaml.NewDecoder(file)
+			dec.SetStrict(strict)
+			return dec, nil
+		case "toml":
+			return &tomlDecoder{file: file, strict: strict}, nil
+		case "hcl":
+			return &hclDecoder{file: file}, nil
 		default:
-			return nil, fmt.Errorf(`Invalid file type "%s"`, fileExt)
-	}//-- end switch	
+			return nil, fmt.Errorf(`Invalid file type "%s"`, format)
+	}//-- end switch
 }//-- end func getDecoder
 
-func LoadConfig (filename string) (*Config, error) {
-	file, err := os.Open(filename)
-	if err != nil { return nil, err }
-	defer file.Close()
-	path := strings.Split(filename, ".")
-	ext := path[len(path) - 1]
-	dec, err := getDecoder(file, ext)
-	if err != nil { return nil, err }
-	config := &Config{}
-	err = dec.Decode(config)
+// Loads a config from r, in the given format, or one sniffed from the
+// content if format is empty; environment overrides and secret
+// references are applied, and the result validated, as by LoadConfig.
+func LoadConfigReader (r io.Reader, format string) (*Config, error) {
+	config := DefaultConfig()
+	dec, err := getDecoder(r, format, true)
 	if err != nil { return nil, err }
+	err = config.decodeFrom(dec)
+	if err != nil && err != io.EOF { return nil, err }
+	loader := &ConfigLoader{}
+	if err = loader.finish(config, true); err != nil { return nil, err }
 	return config, nil
-}//-- end func LoadConfig
+}//-- end func LoadConfigReader
+
+// Returns every problem found in the config, including its sections, as
+// ConfigErrors
+func (cfg *Config) Validate () error {
+	var errs ConfigErrors
+	if cfg.WaitSecs < 0 { errs.Add(errors.New("Negative WaitSecs in Config")) }
+	if cfg.LogLevel != "" {
+		if _, err := ParseLogLevel(cfg.LogLevel); err != nil { errs.Add(err) }
+	}
+	serverCfg := cfg.serverConfig()
+	if err := serverCfg.Validate(); err != nil {
+		errs.Add(prefixErrors("Server: ", err))
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		errs.Add(prefixErrors("Database: ", err))
+	}
+	cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+		section, ok := val.Addr().Interface().(interface{ Validate () error })
+		if !ok { return }
+		if err := section.Validate(); err != nil {
+			errs.Add(prefixErrors(name + ": ", err))
+		}
+	})
+	return errs.Err()
+}//-- end func Config.Validate
+
+// Returns a copy of cfg.Server, its Index and StaticDir defaulting to
+// the top-level settings
+func (cfg *Config) serverConfig () ServerConfig {
+	serverCfg := cfg.Server
+	if serverCfg.Index == "" { serverCfg.Index = cfg.Index }
+	if serverCfg.StaticDir == "" { serverCfg.StaticDir = cfg.StaticDir }
+	return serverCfg
+}//-- end func Config.serverConfig
 
+func prefixErrors (prefix string, err error) error {
+	nested, ok := err.(ConfigErrors)
+	if !ok { return errors.New(prefix + err.Error()) }
+	var errs ConfigErrors
+	for _, e := range nested { errs.Add(errors.New(prefix + e.Error())) }
+	return errs
+}//-- end func prefixErrors
+
+// Decodes the config file ("-" for stdin), overlaid by those for the
+// profile named by WEBAPP_PROFILE and the local overlay (see profile.go),
+// then applies overrides from the environment (see env.go), and
+// validates the result.
+func LoadConfig (filename string) (*Config, error) {
+	return LoadConfigProfile(filename, os.Getenv(EnvPrefix + "_PROFILE"))
+}//-- end func LoadConfig
@@ -0,0 +1,131 @@
+package webapp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecoding (t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"config.json": "{\n\t\"Index\": \"index.html\",\n\t\"Server\": {\n" +
+			"\t\t\"Prot\": \":80\"\n\t}\n}\n",
+		"config.yml": "index: index.html\nserver:\n  prot: \":80\"\n"}
+	for name, content := range cases {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loader := &ConfigLoader{Filename: filename, SkipEnv: true,
+			SkipValidate: true}
+		_, err := loader.Load()
+		if err == nil || !strings.Contains(err.Error(), "line ") ||
+				!strings.Contains(strings.ToLower(err.Error()), "prot") {
+			t.Errorf("%s: got error %v", name, err)
+		}
+		loader.Lenient = true
+		if _, err = loader.Load(); err != nil {
+			t.Errorf("%s: lenient load failed: %s", name, err.Error())
+		}
+	}//-- end for range cases
+}//-- end TestStrictDecoding
+
+// Supplies the settings Config.Validate requires, for tests of decoding
+// partial configs through LoadConfigReader
+func setRequiredEnv (t *testing.T) {
+	t.Setenv("WEBAPP_SERVER_STATIC_DIR", "static")
+	t.Setenv("WEBAPP_DATABASE_DATABASE_NAME", "app")
+}//-- end func setRequiredEnv
+
+func TestLoadValidates (t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	content := "waitsecs: -5\nserver:\n  staticdir: static\n  maxconns: -3\n" +
+		"database:\n  databasename: app\n"
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader := &ConfigLoader{Filename: filename, SkipEnv: true}
+	_, err := loader.Load()
+	if errs, ok := err.(ConfigErrors); !ok || len(errs) != 2 ||
+			!strings.Contains(err.Error(), "WaitSecs") ||
+			!strings.Contains(err.Error(), "Server: Negative") {
+		t.Errorf("invalid file loaded: %v", err)
+	}
+	loader.SkipValidate = true
+	if _, err = loader.Load(); err != nil { t.Errorf("SkipValidate: %v", err) }
+	_, err = LoadConfigReader(strings.NewReader(content), "yaml")
+	if err == nil { t.Error("invalid config read") }
+}//-- end TestLoadValidates
+
+func TestConfigServerDefaults (t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.StaticDir, cfg.Database.DatabaseName = "static", "app"
+	if err := cfg.Validate(); err != nil { t.Fatal(err) }
+	serverCfg := cfg.serverConfig()
+	if serverCfg.StaticDir != "static" || serverCfg.Index != "index.html" {
+		t.Errorf("top-level settings not applied: %+v", serverCfg)
+	}
+	if cfg.Server.StaticDir != "" || cfg.Server.Index != "" {
+		t.Error("config modified")
+	}
+	cfg.Server.StaticDir = "public"
+	if dir := cfg.serverConfig().StaticDir; dir != "public" {
+		t.Errorf("server.staticdir overridden by %s", dir)
+	}
+}//-- end TestConfigServerDefaults
+
+func TestConfigValidate (t *testing.T) {
+	cfg := &Config{WaitSecs: -1, LogLevel: "loud",
+		Server: ServerConfig{StaticDir: "static", MaxConns: -1},
+		Database: DatabaseConfig{Protocol: "udp", Address: "localhost"}}
+	err := cfg.Validate()
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 6 {
+		t.Fatalf("got %v, want six ConfigErrors", err)
+	}
+	for _, want := range []string{"WaitSecs", "log level", "Server: No Port",
+			"Server: Negative load limit", `Database: Invalid database Protocol`,
+			"Database: No DatabaseName"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in %s", want, err.Error())
+		}
+	}//-- end for range wants
+}//-- end TestConfigValidate
+
+func TestConfigFormats (t *testing.T) {
+	setRequiredEnv(t)
+	sources := map[string]string{
+		"json": `{"index": "index.html", "Server": {"port": ":80",
+			"trustedproxies": ["10.0.0.0/8"]}, "database": {"username": "app"}}`,
+		"xml": "<Config><Index>index.html</Index><server><Port>:80</Port>" +
+			"<trustedproxies>10.0.0.0/8</trustedproxies></server>" +
+			"<database><username>app</username></database></Config>",
+		"yaml": "# comment\nindex: index.html\nserver:\n  port: \":80\"\n" +
+			"  trustedproxies: [10.0.0.0/8]\ndatabase:\n  username: app\n",
+		"toml": "index = \"index.html\"\n\n[server]\nport = \":80\"\n" +
+			"trustedproxies = [\"10.0.0.0/8\"]\n\n[database]\nusername = \"app\"\n",
+		"hcl": "index = \"index.html\"\nserver {\n  port = \":80\"\n" +
+			"  trustedproxies = [\"10.0.0.0/8\"]\n}\n" +
+			"database {\n  username = \"app\"\n}\n"}
+	for format, source := range sources {
+		if got := sniffFormat([]byte(source)); got != format {
+			t.Errorf("%s sniffed as %s", format, got)
+		}
+		for _, given := range []string{format, ""} {
+			cfg, err := LoadConfigReader(strings.NewReader(source), given)
+			if err != nil {
+				t.Errorf("%s (%q): %s", format, given, err.Error())
+				continue
+			}
+			if cfg.Index != "index.html" || cfg.Server.Port != ":80" ||
+					len(cfg.Server.TrustedProxies) != 1 ||
+					cfg.Database.Username != "app" {
+				t.Errorf("%s (%q): unexpected config %+v", format, given, cfg)
+			}
+		}//-- end for range formats given
+	}//-- end for range sources
+	_, err := LoadConfigReader(strings.NewReader("[server]\nprot = 1\n"), "")
+	if err == nil { t.Error("unknown TOML key accepted") }
+}//-- end TestConfigFormats
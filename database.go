@@ -11,17 +11,45 @@ package webapp
  */
 
 import (
+	"errors"
+	"fmt"
 	"gopkg.in/ollykel/webapp.v0/model"
 )
 
+// Settings are described in help.go
 type DatabaseConfig struct {
-	Protocol string
-	Address string
-	DatabaseName string
-	Username string
-	Password string
+	// see dsn.go
+	DSN string `json:"dsn" xml:"dsn" toml:"dsn" secret:"true"`
+	Protocol string `json:"protocol" xml:"protocol" toml:"protocol" default:"tcp"`
+	Address string `json:"address" xml:"address" toml:"address" default:"localhost:3306"`
+	DatabaseName string `json:"databasename" xml:"databasename" toml:"databasename"`
+	Username string `json:"username" xml:"username" toml:"username"`
+	// see secrets.go
+	Password string `json:"password" xml:"password" toml:"password" secret:"true"`
+	PasswordFile string `json:"passwordfile" xml:"passwordfile" toml:"passwordfile"`
+	Params DatabaseParams `json:"params" xml:"params" toml:"params"`
 }//-- end DatabaseConfig struct
 
+// Returns every problem found, as ConfigErrors
+func (cfg *DatabaseConfig) Validate () error {
+	resolved, err := cfg.Resolve()
+	if err != nil { return err }
+	cfg = &resolved
+	var errs ConfigErrors
+	switch (cfg.Protocol) {
+		case "", "tcp", "tcp4", "tcp6", "unix":
+		default:
+			errs.Add(fmt.Errorf(`Invalid database Protocol "%s"`, cfg.Protocol))
+	}//-- end switch
+	if cfg.Address == "" {
+		errs.Add(errors.New("No Address provided to DatabaseConfig"))
+	}
+	if cfg.DatabaseName == "" {
+		errs.Add(errors.New("No DatabaseName provided to DatabaseConfig"))
+	}
+	return errs.Err()
+}//-- end func DatabaseConfig.Validate
+
 type Database interface {
 	// Initializes db connection, throws error on failure
 	Init (config *DatabaseConfig) error
@@ -11,6 +11,7 @@ import (
 	"database/sql"
 	"fmt"
 	"context"
+	"sort"
 	"strings"
 	"log"
 	// database driver
@@ -22,11 +23,13 @@ import (
 
 const (
 	driverName = "mymysql"
-	dataSourceFmt = "%s:%s*%s/%s/%s"
-	//-- Protocol:Address*DatabaseName/Username/Password
-	//-- User:Password@Protocol(Address)/DatabaseName
+	dataSourceFmt = "%s:%s%s*%s/%s/%s"
+	//-- Protocol:Address,Options*DatabaseName/Username/Password
 )
 
+// The only Params the driver takes, as options of its DSN
+var driverOptions = map[string]bool{"laddr": true, "timeout": true}
+
 type Scannable interface {
 	Scan(dest ...interface{}) error
 }//-- end Scannable interface
@@ -35,10 +38,43 @@ type Database struct {
 	pool *sql.DB
 }//-- end Database struct
 
+// Formats the driver's DSN. It has no escapes, so parts holding its
+// separators are rejected; the password, coming last, may hold anything.
+func dataSource (cfg *app.DatabaseConfig) (string, error) {
+	resolved, err := cfg.Resolve()
+	if err != nil { return "", err }
+	if strings.ContainsAny(resolved.Address, ",*") {
+		return "", fmt.Errorf("database Address may not contain ',' or '*'")
+	}
+	if strings.ContainsAny(resolved.DatabaseName + resolved.Username, "/*") {
+		return "", fmt.Errorf("database name and user may not contain " +
+			"'/' or '*'")
+	}
+	names := make([]string, 0, len(resolved.Params))
+	for name := range resolved.Params { names = append(names, name) }
+	sort.Strings(names)
+	options := ""
+	for _, name := range names {
+		value := resolved.Params[name]
+		if !driverOptions[name] {
+			return "", fmt.Errorf(`database parameter "%s" not supported ` +
+				"by mymysql", name)
+		}
+		if strings.ContainsAny(value, ",*") {
+			return "", fmt.Errorf(`database parameter "%s" may not contain ` +
+				"',' or '*'", name)
+		}
+		options += "," + name + "=" + value
+	}//-- end for range params
+	return fmt.Sprintf(dataSourceFmt, resolved.Protocol, resolved.Address,
+		options, resolved.DatabaseName, resolved.Username,
+		resolved.Password), nil
+}//-- end func dataSource
+
 func (db *Database) Init (cfg *app.DatabaseConfig) (err error) {
-	dataSource := fmt.Sprintf(dataSourceFmt, cfg.Protocol, cfg.Address,
-		cfg.DatabaseName, cfg.Username, cfg.Password)
-	db.pool, err = sql.Open(driverName, dataSource)
+	dsn, err := dataSource(cfg)
+	if err != nil { return }
+	db.pool, err = sql.Open(driverName, dsn)
 	if err != nil { return }
 	err = db.pool.Ping()
 	return
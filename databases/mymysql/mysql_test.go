@@ -0,0 +1,39 @@
+package mysql
+
+import (
+	"testing"
+	// local imports
+	app "gopkg.in/ollykel/webapp.v0"
+)
+
+func TestDataSource (t *testing.T) {
+	cfg := &app.DatabaseConfig{Protocol: "tcp", Address: "db:3306",
+		DatabaseName: "app", Username: "app", Password: "p*/@,w",
+		Params: app.DatabaseParams{"timeout": "5s"}}
+	dsn, err := dataSource(cfg)
+	if err != nil { t.Fatal(err) }
+	if want := "tcp:db:3306,timeout=5s*app/app/p*/@,w"; dsn != want {
+		t.Errorf("got %s, want %s", dsn, want)
+	}
+	cfg.DSN = "u:pw@unix(/run/mysqld.sock)/db?laddr=127.0.0.1:0"
+	if dsn, err = dataSource(cfg); err != nil { t.Fatal(err) }
+	if want := "unix:/run/mysqld.sock,laddr=127.0.0.1:0,timeout=5s*db/u/pw";
+			dsn != want {
+		t.Errorf("got %s, want %s", dsn, want)
+	}
+	rejected := []app.DatabaseConfig{
+		{Address: "db:3306,laddr=x", DatabaseName: "app"},
+		{Address: "db*3306", DatabaseName: "app"},
+		{Address: "db:3306", DatabaseName: "a/pp"},
+		{Address: "db:3306", DatabaseName: "app", Username: "u*"},
+		{Address: "db:3306", DatabaseName: "app",
+			Params: app.DatabaseParams{"parseTime": "true"}},
+		{Address: "db:3306", DatabaseName: "app",
+			Params: app.DatabaseParams{"timeout": "5s,laddr=x"}}}
+	for _, bad := range rejected {
+		bad.Protocol = "tcp"
+		if dsn, err := dataSource(&bad); err == nil {
+			t.Errorf("accepted %+v as %s", bad, dsn)
+		}
+	}//-- end for range rejected
+}//-- end TestDataSource
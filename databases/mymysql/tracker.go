@@ -73,7 +73,7 @@ func (mt *modelTracker) ToModelDefinition () *model.Definition {
 func (mt *modelTracker) FromModelDefinition (def *model.Definition) {
 	mt.Name = def.Tablename
 	fields, err := json.Marshal(&def.Fields)
-	if err != nil { log.Print(err.Error) }
+	if err != nil { log.Print(err.Error()) }
 	mt.Fields = string(fields)
 }//-- end func modelTracker.FromModelDefinition
 
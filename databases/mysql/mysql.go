@@ -9,23 +9,17 @@ package mysql
 
 import (
 	"database/sql"
-	"fmt"
 	"context"
+	"fmt"
 	"strings"
 	"log"
 	// database driver
-	_"github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	// local imports
 	app "gopkg.in/ollykel/webapp.v0"
 	"gopkg.in/ollykel/webapp.v0/model"
 )
 
-const (
-	driverName = "mysql"
-	dataSourceFmt = "%s:%s@%s(%s)/%s"
-	//-- User:Password@Protocol(Address)/DatabaseName
-)
-
 type Scannable interface {
 	Scan(dest ...interface{}) error
 }//-- end Scannable interface
@@ -34,11 +28,30 @@ type Database struct {
 	pool *sql.DB
 }//-- end Database struct
 
+// Builds the driver's config from cfg. The driver parses the params
+// itself, as in a DSN; the other parts are set directly, so that none
+// needs escaping.
+func driverConfig (cfg *app.DatabaseConfig) (*mysql.Config, error) {
+	resolved, err := cfg.Resolve()
+	if err != nil { return nil, err }
+	driverCfg, err := mysql.ParseDSN("/?" + resolved.Params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database parameters: %s", err.Error())
+	}
+	driverCfg.User, driverCfg.Passwd = resolved.Username, resolved.Password
+	driverCfg.Net, driverCfg.Addr = resolved.Protocol, resolved.Address
+	driverCfg.DBName = resolved.DatabaseName
+	//-- rebuilt by the connector from TLSConfig, for the address set here
+	driverCfg.TLS = nil
+	return driverCfg, nil
+}//-- end func driverConfig
+
 func (db *Database) Init (cfg *app.DatabaseConfig) (err error) {
-	dataSource := fmt.Sprintf(dataSourceFmt, cfg.Username, cfg.Password,
-		cfg.Protocol, cfg.Address, cfg.DatabaseName)
-	db.pool, err = sql.Open(driverName, dataSource)
+	driverCfg, err := driverConfig(cfg)
+	if err != nil { return }
+	connector, err := mysql.NewConnector(driverCfg)
 	if err != nil { return }
+	db.pool = sql.OpenDB(connector)
 	err = db.pool.Ping()
 	return
 }//-- end func initDatabase
@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+	// imported packages
+	"github.com/go-sql-driver/mysql"
+	// local imports
+	app "gopkg.in/ollykel/webapp.v0"
+)
+
+func TestDriverConfig (t *testing.T) {
+	cfg := &app.DatabaseConfig{Protocol: "tcp", Address: "localhost:3306",
+		DSN: "mysql://us%40r:p%3Fa%2Fss%40w@db:3307/my%2Fdb" +
+			"?parseTime=true&loc=Europe/Paris&timeout=5s&time_zone=%27%2B00%3A00%27",
+		Params: app.DatabaseParams{"charset": "utf8mb4", "timeout": "1s",
+			"tls": "skip-verify", "timeTruncate": "1s",
+			"connectionAttributes": "app:web"}}
+	driverCfg, err := driverConfig(cfg)
+	if err != nil { t.Fatal(err) }
+	if driverCfg.User != "us@r" || driverCfg.Passwd != "p?a/ss@w" ||
+			driverCfg.Net != "tcp" || driverCfg.Addr != "db:3307" ||
+			driverCfg.DBName != "my/db" {
+		t.Errorf("unexpected connection %+v", driverCfg)
+	}
+	if !driverCfg.ParseTime || driverCfg.Loc.String() != "Europe/Paris" ||
+			driverCfg.Timeout != 5 * time.Second ||
+			driverCfg.TLSConfig != "skip-verify" ||
+			driverCfg.Params["time_zone"] != "'+00:00'" ||
+			driverCfg.ConnectionAttributes != "app:web" ||
+			len(driverCfg.Params) != 1 {
+		t.Errorf("unexpected params %+v", driverCfg)
+	}
+	//-- the driver must read back exactly what was set
+	parsed, err := mysql.ParseDSN(driverCfg.FormatDSN())
+	if err != nil { t.Fatal(err) }
+	if parsed.User != driverCfg.User || parsed.Passwd != driverCfg.Passwd ||
+			parsed.DBName != driverCfg.DBName {
+		t.Errorf("round trip gave %+v", parsed)
+	}
+	if _, err = mysql.NewConnector(driverCfg); err != nil { t.Error(err) }
+	cfg.DSN, cfg.Params = "", app.DatabaseParams{"parseTime": "maybe"}
+	if _, err = driverConfig(cfg); err == nil {
+		t.Error("invalid boolean parameter accepted")
+	}
+}//-- end TestDriverConfig
@@ -0,0 +1,191 @@
+package webapp
+
+/**
+ * Config defaults. A field's `default` tag gives the value it takes
+ * unless a config file, the environment or a flag sets another, in the
+ * form an environment variable would (see env.go). ConfigLoader applies
+ * defaults before decoding; a hand-built Config may start from
+ * DefaultConfig, or call SetDefaults. WriteSampleConfig writes the
+ * defaults out as a config file, with each setting described as in
+ * help.go, as a starting point kept in step with the structs.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	// imported packages
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Returns a config holding only defaults, including those of registered
+// sections
+func DefaultConfig () *Config {
+	cfg := &Config{}
+	cfg.SetDefaults()
+	return cfg
+}//-- end func DefaultConfig
+
+// Sets every zero-valued field having a `default` tag, in cfg and its
+// sections, to that default. Panics if a default cannot be parsed.
+func (cfg *Config) SetDefaults () {
+	setDefaults(reflect.ValueOf(cfg).Elem(), "")
+	cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+		setDefaults(val, name)
+	})
+}//-- end func Config.SetDefaults
+
+func setDefaults (val reflect.Value, name string) {
+	switch (val.Kind()) {
+		case reflect.Struct:
+			typ := val.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field, fieldVal := typ.Field(i), val.Field(i)
+				if field.PkgPath != "" { continue }
+				fieldName := field.Name
+				if name != "" { fieldName = name + "." + field.Name }
+				def, exists := field.Tag.Lookup("default")
+				if !exists || !fieldVal.IsZero() {
+					setDefaults(fieldVal, fieldName)
+					continue
+				}
+				if err := setFromString(fieldVal, def); err != nil {
+					panic(fmt.Sprintf("webapp: default of %s: %s", fieldName,
+						err.Error()))
+				}
+			}//-- end for range fields
+		case reflect.Slice:
+			for i := 0; i < val.Len(); i++ {
+				setDefaults(val.Index(i), fmt.Sprintf("%s[%d]", name, i))
+			}
+	}//-- end switch
+}//-- end func setDefaults
+
+// Writes a sample config holding the defaults, in "yaml", "toml" or
+// "json". YAML and TOML samples describe each setting in a comment; JSON
+// has no comments, so its sample is just DefaultConfig encoded.
+func WriteSampleConfig (w io.Writer, format string) error {
+	cfg := DefaultConfig()
+	switch (format) {
+		case "json":
+			return cfg.Encode(w, "json")
+		case "yaml", "yml":
+			var buf bytes.Buffer
+			err := writeYAMLSample(&buf, reflect.ValueOf(cfg).Elem(), "", "")
+			cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+				if err != nil { return }
+				fmt.Fprintf(&buf, "\n%s:\n", name)
+				err = writeYAMLSample(&buf, val, name, "  ")
+			})
+			if err != nil { return err }
+			_, err = buf.WriteTo(w)
+			return err
+		case "toml":
+			var buf bytes.Buffer
+			err := writeTOMLSample(&buf, reflect.ValueOf(cfg).Elem(), "")
+			cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+				if err != nil { return }
+				fmt.Fprintf(&buf, "\n[%s]\n", name)
+				err = writeTOMLSample(&buf, val, name)
+			})
+			if err != nil { return err }
+			_, err = buf.WriteTo(w)
+			return err
+		default:
+			return fmt.Errorf(`Invalid sample file type "%s"`, format)
+	}//-- end switch
+}//-- end func WriteSampleConfig
+
+// Returns the key of a field in config files, or "" if it has none
+func configKey (field reflect.StructField) string {
+	if field.PkgPath != "" { return "" }
+	key := strings.Split(field.Tag.Get("json"), ",")[0]
+	if key == "-" { return "" }
+	if key == "" { key = strings.ToLower(field.Name) }
+	return key
+}//-- end func configKey
+
+func isTable (val reflect.Value) bool {
+	return val.Kind() == reflect.Struct && val.Type() != timeType
+}//-- end func isTable
+
+// Joins a key to the path of its parent, as flags are named
+func keyPath (parent, key string) string {
+	if parent == "" { return key }
+	return parent + "." + key
+}//-- end func keyPath
+
+func writeComment (w io.Writer, field reflect.StructField, path,
+		indent string) {
+	if help := fieldHelp(field, path); help != "" {
+		fmt.Fprintf(w, "%s# %s\n", indent, help)
+	}
+}//-- end func writeComment
+
+func writeYAMLSample (w io.Writer, val reflect.Value, parent,
+		indent string) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key := configKey(field)
+		if key == "" { continue }
+		if indent == "" && isTable(val.Field(i)) { fmt.Fprintln(w) }
+		writeComment(w, field, keyPath(parent, key), indent)
+		if isTable(val.Field(i)) {
+			fmt.Fprintf(w, "%s%s:\n", indent, key)
+			err := writeYAMLSample(w, val.Field(i), keyPath(parent, key),
+				indent + "  ")
+			if err != nil { return err }
+			continue
+		}
+		output, err := yaml.Marshal(map[string]interface{}{
+			key: val.Field(i).Interface()})
+		if err != nil { return err }
+		for _, line := range strings.SplitAfter(string(output), "\n") {
+			if line != "" { fmt.Fprint(w, indent + line) }
+		}
+	}//-- end for range fields
+	return nil
+}//-- end func writeYAMLSample
+
+// Writes the values of val, then its tables, as TOML requires
+func writeTOMLSample (w io.Writer, val reflect.Value, table string) error {
+	typ := val.Type()
+	var tables []int
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key := configKey(field)
+		if key == "" { continue }
+		if isTable(val.Field(i)) {
+			tables = append(tables, i)
+			continue
+		}
+		writeComment(w, field, keyPath(table, key), "")
+		fieldVal := val.Field(i)
+		switch {//-- the encoder would omit these
+			case fieldVal.Kind() == reflect.Slice && fieldVal.Len() == 0:
+				fmt.Fprintf(w, "%s = []\n", key)
+				continue
+			case fieldVal.Kind() == reflect.Map && fieldVal.Len() == 0:
+				fmt.Fprintf(w, "%s = {}\n", key)
+				continue
+		}//-- end switch
+		err := toml.NewEncoder(w).Encode(map[string]interface{}{
+			key: val.Field(i).Interface()})
+		if err != nil { return err }
+	}//-- end for range fields
+	for _, i := range tables {
+		field := typ.Field(i)
+		name := keyPath(table, configKey(field))
+		fmt.Fprintln(w)
+		writeComment(w, field, name, "")
+		fmt.Fprintf(w, "[%s]\n", name)
+		if err := writeTOMLSample(w, val.Field(i), name); err != nil {
+			return err
+		}
+	}//-- end for range tables
+	return nil
+}//-- end func writeTOMLSample
@@ -0,0 +1,50 @@
+package webapp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSetDefaults (t *testing.T) {
+	cfg := &Config{Server: ServerConfig{Port: ":80"}}
+	cfg.SetDefaults()
+	if cfg.Index != "index.html" || cfg.Server.Port != ":80" ||
+			cfg.Database.Protocol != "tcp" ||
+			cfg.Server.AccessLog.Output != "stderr" {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+	setRequiredEnv(t)
+	cfg, err := LoadConfigReader(strings.NewReader("index: \"\"\n"), "yaml")
+	if err != nil { t.Fatal(err) }
+	if cfg.Index != "" || cfg.Database.Address != "localhost:3306" {
+		t.Errorf("defaults not overlaid: %+v", cfg)
+	}
+}//-- end TestSetDefaults
+
+func TestWriteSampleConfig (t *testing.T) {
+	setRequiredEnv(t)
+	for _, format := range []string{"yaml", "toml", "json"} {
+		var buf bytes.Buffer
+		if err := WriteSampleConfig(&buf, format); err != nil {
+			t.Fatalf("%s: %s", format, err.Error())
+		}
+		if format != "json" && !strings.Contains(buf.String(),
+				"# address to listen on\n") {
+			t.Errorf("%s: sample lacks help comments:\n%s", format, buf.String())
+		}
+		cfg, err := LoadConfigReader(&buf, format)
+		if err != nil {
+			t.Errorf("%s: sample does not load: %s", format, err.Error())
+			continue
+		}
+		want := DefaultConfig()
+		if cfg.Server.Port != want.Server.Port ||
+				cfg.Database.Address != want.Database.Address ||
+				cfg.Server.SecurityHeaders.ReferrerPolicy !=
+					want.Server.SecurityHeaders.ReferrerPolicy ||
+				cfg.Section("smtp").(*testSMTPConfig).Host != "localhost" {
+			t.Errorf("%s: sample loads as %+v", format, cfg)
+		}
+	}//-- end for range formats
+}//-- end TestWriteSampleConfig
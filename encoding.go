@@ -0,0 +1,71 @@
+package webapp
+
+/**
+ * Precompressed static variants. A file such as app.js may be
+ * accompanied by app.js.br and/or app.js.gz, as produced by bundlers;
+ * clients accepting those encodings are served the variant in place of
+ * the original, with the original's Content-Type.
+ */
+
+import (
+	"strconv"
+	"strings"
+)
+
+// encodings of precompressed siblings, most preferred first
+var staticEncodings = []struct {
+	name, suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}//-- end staticEncodings
+
+// Parses an Accept-Encoding header into the q-value of each coding.
+func parseAcceptEncoding (header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if coding == "" { continue }
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if val, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = val
+				}
+			}
+		}//-- end for range params
+		accepted[coding] = q
+	}//-- end for range items
+	return accepted
+}//-- end func parseAcceptEncoding
+
+func encodingAccepted (accepted map[string]float64, coding string) bool {
+	if q, exists := accepted[coding]; exists { return q > 0 }
+	if coding == "gzip" {
+		if q, exists := accepted["x-gzip"]; exists { return q > 0 }
+	}
+	q, exists := accepted["*"]
+	return exists && q > 0
+}//-- end func encodingAccepted
+
+// Finds the preferred precompressed variant of the file at key that the
+// client accepts. Returns a nil file if there is none; hasVariants
+// reports whether any exist, i.e. whether the response should carry
+// Vary: Accept-Encoding.
+func (hm *handlerMap) Encoded (key, acceptEncoding string) (
+		file *staticFile, coding string, hasVariants bool) {
+	accepted := parseAcceptEncoding(acceptEncoding)
+	hm.mut.RLock()
+	defer hm.mut.RUnlock()
+	for _, enc := range staticEncodings {
+		variant, exists := hm.handlers[key + enc.suffix]
+		if !exists { continue }
+		hasVariants = true
+		if file == nil && encodingAccepted(accepted, enc.name) {
+			file, coding = variant, enc.name
+		}
+	}//-- end for range staticEncodings
+	return file, coding, hasVariants
+}//-- end func handlerMap.Encoded
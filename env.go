@@ -0,0 +1,172 @@
+package webapp
+
+/**
+ * Environment variable overrides for Config. Every field, including
+ * those of nested structs, may be set by a variable named after its path
+ * in SNAKE_CASE beneath a prefix: Database.Password is
+ * WEBAPP_DATABASE_PASSWORD, Server.TLSEnabled is WEBAPP_SERVER_TLS_ENABLED.
+ * A field's `env` tag overrides its name segment, and `env:"-"` exempts
+ * it. Lists of strings are comma-separated; other lists, maps and
+ * structs may be given whole as JSON. A variable with the suffix _FILE
+ * (WEBAPP_DATABASE_PASSWORD_FILE) names a file holding the value, as
+ * with Docker secrets.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// prefix of the variables read by LoadConfig
+const EnvPrefix = "WEBAPP"
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// Converts a Go identifier to SNAKE_CASE, keeping acronyms together:
+// HSTSMaxAgeSecs -> HSTS_MAX_AGE_SECS
+func envName (ident string) string {
+	runes := []rune(ident)
+	var name strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i - 1]
+			nextLower := i + 1 < len(runes) && unicode.IsLower(runes[i + 1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+					(unicode.IsUpper(prev) && nextLower) {
+				name.WriteByte('_')
+			}
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}//-- end for range runes
+	return name.String()
+}//-- end func envName
+
+// Overrides fields of cfg from variables beneath prefix (e.g. EnvPrefix).
+// Values that cannot be converted are left as they were, and listed in
+// the returned ConfigErrors.
+func (cfg *Config) ApplyEnv (prefix string) error {
+	var errs ConfigErrors
+	applyEnv(reflect.ValueOf(cfg).Elem(), prefix, os.LookupEnv, &errs)
+	cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+		applyEnv(val, prefix + "_" + sectionEnvName(name), os.LookupEnv, &errs)
+	})
+	return errs.Err()
+}//-- end func Config.ApplyEnv
+
+// Overrides the fields of the struct val from variables beneath name
+func applyEnv (val reflect.Value, name string,
+		lookup func (string) (string, bool), errs *ConfigErrors) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field, fieldVal := typ.Field(i), val.Field(i)
+		if field.PkgPath != "" { continue }//-- unexported
+		segment := field.Tag.Get("env")
+		if segment == "-" { continue }
+		if field.Anonymous && segment == "" &&
+				fieldVal.Kind() == reflect.Struct {
+			applyEnv(fieldVal, name, lookup, errs)
+			continue
+		}
+		if segment == "" { segment = envName(field.Name) }
+		varName := name + "_" + segment
+		raw, exists := lookup(varName)
+		if !exists {
+			if filename, isFile := lookup(varName + "_FILE"); isFile {
+				var err error
+				raw, err = readSecretFile(filename)
+				if err != nil {
+					errs.Add(fmt.Errorf("%s_FILE: %s", varName, err.Error()))
+					continue
+				}
+				exists = true
+			}
+		}
+		if exists {
+			if err := setFromString(fieldVal, raw); err != nil {
+				errs.Add(fmt.Errorf("%s: %s", varName, err.Error()))
+			}
+		} else if fieldVal.Kind() == reflect.Struct &&
+				fieldVal.Type() != timeType {
+			applyEnv(fieldVal, varName, lookup, errs)
+		}
+	}//-- end for range fields
+}//-- end func applyEnv
+
+// Sets val from its textual form, as given in an environment variable
+// or on the command line.
+func setFromString (val reflect.Value, raw string) error {
+	if val.Type() == durationType {
+		dur, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf(`cannot parse "%s" as a duration`, raw)
+		}
+		val.SetInt(int64(dur))
+		return nil
+	}
+	switch (val.Kind()) {
+		case reflect.String:
+			val.SetString(raw)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf(`cannot parse "%s" as a boolean`, raw)
+			}
+			val.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+				reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, val.Type().Bits())
+			if err != nil {
+				return fmt.Errorf(`cannot parse "%s" as an integer`, raw)
+			}
+			val.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+				reflect.Uint64:
+			n, err := strconv.ParseUint(raw, 10, val.Type().Bits())
+			if err != nil {
+				return fmt.Errorf(`cannot parse "%s" as an unsigned integer`, raw)
+			}
+			val.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(raw, val.Type().Bits())
+			if err != nil {
+				return fmt.Errorf(`cannot parse "%s" as a number`, raw)
+			}
+			val.SetFloat(f)
+		case reflect.Slice:
+			if val.Type().Elem().Kind() == reflect.String &&
+					!strings.HasPrefix(strings.TrimSpace(raw), "[") {
+				items := []string{}
+				for _, item := range strings.Split(raw, ",") {
+					item = strings.TrimSpace(item)
+					if item != "" { items = append(items, item) }
+				}
+				val.Set(reflect.ValueOf(items).Convert(val.Type()))
+				return nil
+			}
+			return setFromJSON(val, raw)
+		case reflect.Map, reflect.Struct, reflect.Array:
+			return setFromJSON(val, raw)
+		default:
+			return fmt.Errorf("cannot set a %s from text", val.Type())
+	}//-- end switch
+	return nil
+}//-- end func setFromString
+
+func setFromJSON (val reflect.Value, raw string) error {
+	ptr := reflect.New(val.Type())
+	if err := json.Unmarshal([]byte(raw), ptr.Interface()); err != nil {
+		return fmt.Errorf("cannot parse value as JSON %s: %s", val.Type(),
+			err.Error())
+	}
+	val.Set(ptr.Elem())
+	return nil
+}//-- end func setFromJSON
@@ -0,0 +1,55 @@
+package webapp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvName (t *testing.T) {
+	cases := map[string]string{
+		"Password": "PASSWORD",
+		"DatabaseName": "DATABASE_NAME",
+		"TLSEnabled": "TLS_ENABLED",
+		"HSTSMaxAgeSecs": "HSTS_MAX_AGE_SECS",
+		"CertFile": "CERT_FILE",
+		"SPAExcludePrefixes": "SPA_EXCLUDE_PREFIXES"}
+	for ident, want := range cases {
+		if got := envName(ident); got != want {
+			t.Errorf("%s: got %s, want %s", ident, got, want)
+		}
+	}//-- end for range cases
+}//-- end TestEnvName
+
+func TestApplyEnv (t *testing.T) {
+	t.Setenv("TEST_DATABASE_PASSWORD", "hunter2")
+	t.Setenv("TEST_WAIT_SECS", "30")
+	t.Setenv("TEST_SERVER_TLS_ENABLED", "true")
+	t.Setenv("TEST_SERVER_STATIC_STREAM_THRESHOLD", "1048576")
+	t.Setenv("TEST_SERVER_TRUSTED_PROXIES", "10.0.0.0/8, 127.0.0.1")
+	t.Setenv("TEST_SERVER_CACHE_RULES",
+		`[{"Pattern": "*.html", "CacheControl": "no-cache"}]`)
+	t.Setenv("TEST_SERVER_ACCESS_LOG_SAMPLE_RATE", "0.5")
+	cfg := &Config{Index: "index.html", WaitSecs: 5}
+	if err := cfg.ApplyEnv("TEST"); err != nil { t.Fatal(err) }
+	if cfg.Database.Password != "hunter2" || cfg.WaitSecs != 30 ||
+			!cfg.Server.TLSEnabled || cfg.Server.StaticStreamThreshold != 1048576 ||
+			len(cfg.Server.TrustedProxies) != 2 ||
+			cfg.Server.TrustedProxies[1] != "127.0.0.1" ||
+			len(cfg.Server.CacheRules) != 1 ||
+			cfg.Server.AccessLog.SampleRate != 0.5 ||
+			cfg.Index != "index.html" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	t.Setenv("TEST_WAIT_SECS", "soon")
+	t.Setenv("TEST_SERVER_MAX_CONNS", "many")
+	err := cfg.ApplyEnv("TEST")
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("got error %v, want two ConfigErrors", err)
+	}
+	if !strings.Contains(err.Error(), "TEST_WAIT_SECS") ||
+			!strings.Contains(err.Error(), "TEST_SERVER_MAX_CONNS") {
+		t.Errorf("errors do not name the variables: %s", err.Error())
+	}
+	if cfg.WaitSecs != 30 { t.Errorf("bad value applied: %d", cfg.WaitSecs) }
+}//-- end TestApplyEnv
@@ -0,0 +1,93 @@
+package webapp
+
+/**
+ * Asset fingerprinting for cache busting. When ServerConfig.Fingerprint
+ * is set, every static file other than HTML pages and precompressed
+ * siblings (see encoding.go) is also served under a name carrying a hash
+ * of its content (app.js -> app.3f9a1c0b2e.js), with immutable
+ * long-lived caching. The original names remain, cached per
+ * CacheRules/CacheTimeoutSecs as usual. The manifest mapping
+ * original to fingerprinted paths is exposed through AssetPath, and to
+ * templates through Webapp.TemplateFuncs.
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+)
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+func (file *staticFile) fingerprint () string {
+	sum := sha256.Sum256([]byte(file.etag))
+	return hex.EncodeToString(sum[:5])
+}//-- end func staticFile.fingerprint
+
+// Inserts fp before the extension of key's base name
+func fingerprintedName (key, fp string) string {
+	dir, base := path.Split(key)
+	ext := path.Ext(base)
+	return dir + strings.TrimSuffix(base, ext) + "." + fp + ext
+}//-- end func fingerprintedName
+
+// HTML pages are entry points, linked to by their fixed names;
+// precompressed siblings are served through their original's name
+func fingerprintable (key string) bool {
+	ext := strings.ToLower(path.Ext(key))
+	for _, enc := range staticEncodings {
+		if ext == enc.suffix { return false }
+	}
+	return ext != ".html" && ext != ".htm"
+}//-- end func fingerprintable
+
+// Registers the fingerprinted alias of the file at key, replacing any
+// previous one. Caller must hold mut.
+func (hm *handlerMap) addFingerprint (key string, file *staticFile) {
+	hm.dropFingerprint(key)
+	if !hm.fingerprint || !fingerprintable(key) { return }
+	alias := fingerprintedName(key, file.fingerprint())
+	hm.aliases[alias], hm.manifest[key] = key, alias
+}//-- end func handlerMap.addFingerprint
+
+// Caller must hold mut.
+func (hm *handlerMap) dropFingerprint (key string) {
+	if alias, exists := hm.manifest[key]; exists {
+		delete(hm.aliases, alias)
+		delete(hm.manifest, key)
+	}
+}//-- end func handlerMap.dropFingerprint
+
+// Like Get, but also resolves fingerprinted names. Returns the file's
+// original key, and whether key was a fingerprinted name.
+func (hm *handlerMap) Lookup (key string) (*staticFile, string, bool) {
+	hm.mut.RLock()
+	defer hm.mut.RUnlock()
+	if file, exists := hm.handlers[key]; exists { return file, key, false }
+	if original, exists := hm.aliases[key]; exists {
+		return hm.handlers[original], original, true
+	}
+	return nil, "", false
+}//-- end func handlerMap.Lookup
+
+// Returns the fingerprinted form of a static file's URL path, or the path
+// unchanged if it has none.
+func (hm *handlerMap) AssetPath (urlPath string) string {
+	key := "/" + strings.TrimPrefix(urlPath, "/")
+	hm.mut.RLock()
+	defer hm.mut.RUnlock()
+	alias, exists := hm.manifest[key]
+	if !exists { return urlPath }
+	if !strings.HasPrefix(urlPath, "/") { return alias[1:] }
+	return alias
+}//-- end func handlerMap.AssetPath
+
+// Returns a copy of the manifest, from original to fingerprinted paths.
+func (hm *handlerMap) Manifest () map[string]string {
+	hm.mut.RLock()
+	defer hm.mut.RUnlock()
+	manifest := make(map[string]string, len(hm.manifest))
+	for key, alias := range hm.manifest { manifest[key] = alias }
+	return manifest
+}//-- end func handlerMap.Manifest
@@ -0,0 +1,186 @@
+package webapp
+
+/**
+ * Command-line flags for Config. Every field is bound to a flag named by
+ * its path of lowercase keys, as in config files: Server.Port is
+ * --server.port (or -server.port), and a field of a registered section
+ * (see sections.go) --<section>.<key>. Values take the forms accepted by
+ * environment variables (see env.go); fields tagged json:"-" have none.
+ * Each flag is described as in help.go.
+ *
+ * ConfigLoader.LoadArgs layers flags above the config files and the
+ * environment, adding --config and --profile to choose the files:
+ *
+ *	loader := &webapp.ConfigLoader{Filename: "config.yml"}
+ *	cfg, err := loader.LoadArgs(os.Args[0], os.Args[1:])
+ *	if err == flag.ErrHelp { os.Exit(0) }
+ */
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// A flag given on the command line, reapplied by every Load
+type flagArg struct {
+	name, value string
+}//-- end flagArg struct
+
+// Binds a config field to a flag
+type flagValue struct {
+	val reflect.Value
+	secret bool
+	raw string//-- as last given
+}//-- end flagValue struct
+
+func (fv *flagValue) Set (raw string) error {
+	fv.raw = raw
+	return setFromString(fv.val, raw)
+}//-- end func flagValue.Set
+
+func (fv *flagValue) String () string {
+	if fv == nil || !fv.val.IsValid() { return "" }
+	if fv.secret && fv.val.Kind() == reflect.String && fv.val.Len() > 0 {
+		return redacted
+	}
+	switch (fv.val.Kind()) {
+		case reflect.Slice:
+			if fv.val.Type().Elem().Kind() == reflect.String {
+				items := make([]string, fv.val.Len())
+				for i := range items { items[i] = fv.val.Index(i).String() }
+				return strings.Join(items, ",")
+			}
+			if fv.val.Len() == 0 { return "" }
+			fallthrough
+		case reflect.Map, reflect.Struct, reflect.Array:
+			if fv.val.Kind() == reflect.Map && fv.val.Len() == 0 { return "" }
+			output, _ := json.Marshal(fv.val.Interface())
+			return string(output)
+		default:
+			return fmt.Sprint(fv.val.Interface())
+	}//-- end switch
+}//-- end func flagValue.String
+
+// Lets boolean flags be given without a value
+func (fv *flagValue) IsBoolFlag () bool {
+	return fv.val.Kind() == reflect.Bool
+}//-- end func flagValue.IsBoolFlag
+
+// Describes the values taken, for usage
+func (fv *flagValue) typeName () string {
+	if fv.val.Type() == durationType { return "duration" }
+	switch (fv.val.Kind()) {
+		case reflect.Bool:
+			return ""
+		case reflect.Slice:
+			if fv.val.Type().Elem().Kind() == reflect.String { return "list" }
+			return "json"
+		case reflect.Map, reflect.Struct, reflect.Array:
+			return "json"
+		default:
+			return fv.val.Kind().String()
+	}//-- end switch
+}//-- end func flagValue.typeName
+
+// Defines a flag on fs for each field of cfg and its sections. Flags set
+// the fields directly; their defaults are the fields' current values, with
+// secrets redacted.
+func (cfg *Config) BindFlags (fs *flag.FlagSet) {
+	bindFlags(fs, reflect.ValueOf(cfg).Elem(), "")
+	cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+		bindFlags(fs, val, name)
+	})
+}//-- end func Config.BindFlags
+
+func bindFlags (fs *flag.FlagSet, val reflect.Value, prefix string) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field, fieldVal := typ.Field(i), val.Field(i)
+		key := configKey(field)
+		if key == "" { continue }
+		if field.Anonymous && field.Tag.Get("json") == "" &&
+				fieldVal.Kind() == reflect.Struct {
+			bindFlags(fs, fieldVal, prefix)
+			continue
+		}
+		key = keyPath(prefix, key)
+		if fieldVal.Kind() == reflect.Struct && fieldVal.Type() != timeType {
+			bindFlags(fs, fieldVal, key)
+			continue
+		}
+		fs.Var(&flagValue{val: fieldVal, secret: isSecret(field)}, key,
+			fieldHelp(field, key))
+	}//-- end for range fields
+}//-- end func bindFlags
+
+// Writes a line for each flag of fs, as flag.PrintDefaults, but with the
+// "--" prefix and the types of config values.
+func printFlags (w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func (f *flag.Flag) {
+		line := "  --" + f.Name
+		typeName := "string"
+		if fv, ok := f.Value.(*flagValue); ok { typeName = fv.typeName() }
+		if typeName != "" { line += " " + typeName }
+		line += "\n    \t" + f.Usage
+		if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false" {
+			line += fmt.Sprintf(" (default %q)", f.DefValue)
+		}
+		fmt.Fprintln(w, line)
+	})
+}//-- end func printFlags
+
+// Returns a flag set for the loader's options and the fields of cfg
+func (ld *ConfigLoader) flagSet (name string, cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&ld.Filename, "config", ld.Filename,
+		`config file; "-" reads stdin`)
+	fs.StringVar(&ld.Profile, "profile", ld.Profile,
+		"profile whose config file overlays the base file")
+	cfg.BindFlags(fs)
+	return fs
+}//-- end func ConfigLoader.flagSet
+
+// Parses command-line arguments (excluding the program name), taking
+// --config and --profile as the loader's Filename and Profile, then loads
+// the config with the other flags given applied above the environment,
+// as they are by every later Load. Usage, printed for -h or bad flags,
+// shows the values the config files give. On -h, returns flag.ErrHelp.
+func (ld *ConfigLoader) LoadArgs (name string, args []string) (*Config,
+		error) {
+	ld.flags = nil
+	fs := ld.flagSet(name, &Config{})
+	fs.Usage = func () {
+		current, err := ld.load(false)
+		if err != nil { current = DefaultConfig() }
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", name)
+		printFlags(fs.Output(), ld.flagSet(name, current))
+	}
+	if err := fs.Parse(args); err != nil { return nil, err }
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %s", fs.Arg(0))
+	}
+	fs.Visit(func (f *flag.Flag) {
+		if fv, ok := f.Value.(*flagValue); ok {
+			ld.flags = append(ld.flags, flagArg{f.Name, fv.raw})
+		}
+	})
+	return ld.Load()
+}//-- end func ConfigLoader.LoadArgs
+
+// Applies flags recorded by LoadArgs
+func (ld *ConfigLoader) applyFlags (config *Config) error {
+	if len(ld.flags) == 0 { return nil }
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	config.BindFlags(fs)
+	var errs ConfigErrors
+	for _, arg := range ld.flags {
+		if err := fs.Set(arg.name, arg.value); err != nil {
+			errs.Add(fmt.Errorf("--%s: %s", arg.name, err.Error()))
+		}
+	}
+	return errs.Err()
+}//-- end func ConfigLoader.applyFlags
@@ -0,0 +1,57 @@
+package webapp
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadArgs (t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yml")
+	content := "index: index.html\nserver:\n  port: \":8080\"\n" +
+		"database:\n  password: hunter2\n"
+	if err := ioutil.WriteFile(base, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBAPP_SERVER_PORT", ":9090")
+	loader := &ConfigLoader{Filename: "missing.yml", SkipValidate: true}
+	cfg, err := loader.LoadArgs("app", []string{"--config", base,
+		"--server.port=:80", "--server.tlsenabled",
+		"-server.trustedproxies", "10.0.0.0/8,127.0.0.1",
+		"--server.accesslog.samplerate", "0.5", "--smtp.port", "2525"})
+	if err != nil { t.Fatal(err) }
+	if cfg.Index != "index.html" || cfg.Server.Port != ":80" ||
+			!cfg.Server.TLSEnabled || len(cfg.Server.TrustedProxies) != 2 ||
+			cfg.Server.AccessLog.SampleRate != 0.5 ||
+			cfg.Section("smtp").(*testSMTPConfig).Port != 2525 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg, err = loader.Load(); err != nil || cfg.Server.Port != ":80" {
+		t.Errorf("flags not reapplied on reload: %v", err)
+	}
+	var usage bytes.Buffer
+	fs := loader.flagSet("app", cfg)
+	printFlags(&usage, fs)
+	for _, want := range []string{"--server.port string",
+			"address to listen on", `(default ":80")`, "--server.tlsenabled\n",
+			"--database.password string", `(default "[REDACTED]")`,
+			"--server.trustedproxies list", "--server.cacherules json"} {
+		if !strings.Contains(usage.String(), want) {
+			t.Errorf("usage lacks %q", want)
+		}
+	}//-- end for range wants
+	if strings.Contains(usage.String(), "hunter2") {
+		t.Error("usage shows a secret")
+	}
+	if strings.Contains(usage.String(), "staticfs") {
+		t.Error("usage shows an unloadable field")
+	}
+	_, err = loader.LoadArgs("app", []string{"--server.prot", ":80"})
+	if err == nil { t.Error("unknown flag accepted") }
+	_, err = loader.LoadArgs("app", []string{"-h"})
+	if err != flag.ErrHelp { t.Errorf("got %v for -h", err) }
+}//-- end TestLoadArgs
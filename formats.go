@@ -0,0 +1,168 @@
+package webapp
+
+/**
+ * Config file formats: JSON, XML, YAML, TOML and HCL. The format is
+ * chosen by file extension, or sniffed from the content when there is
+ * none (as when reading stdin). Every format uses the same keys, the
+ * lowercased field names given by the config structs' tags; XML element
+ * names, like JSON, TOML and HCL keys, are matched regardless of case.
+ */
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	// imported packages
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
+)
+
+var configFormats = map[string]string{"json": "json", "xml": "xml",
+	"yaml": "yaml", "yml": "yaml", "toml": "toml", "hcl": "hcl"}
+
+// Returns the format named by filename's extension, or "" if it names
+// none
+func formatOf (filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	return configFormats[ext]
+}//-- end func formatOf
+
+var (
+	tomlTable = regexp.MustCompile(`^\[\[?[\w."-]+\]\]?$`)
+	hclBlock = regexp.MustCompile(`^[\w-]+(\s+"[^"]*")*\s*\{`)
+	assignment = regexp.MustCompile(`^[\w."-]+\s*=`)
+)
+
+// Guesses the format of config content from its first significant line.
+// Where that is "key = value", the content is taken as HCL if any line
+// opens a block, otherwise as TOML.
+func sniffFormat (content []byte) string {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	format := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") ||
+				strings.HasPrefix(line, "//") {
+			continue
+		}
+		if format == "toml" {
+			if hclBlock.MatchString(line) { return "hcl" }
+			continue
+		}
+		switch {
+			case line == "---":
+				return "yaml"
+			case tomlTable.MatchString(line):
+				return "toml"
+			case strings.HasPrefix(line, "{"), strings.HasPrefix(line, "["):
+				return "json"
+			case strings.HasPrefix(line, "<"):
+				return "xml"
+			case hclBlock.MatchString(line):
+				return "hcl"
+			case assignment.MatchString(line):
+				format = "toml"
+			default:
+				return "yaml"
+		}//-- end switch
+	}//-- end for range lines
+	if format == "" { return "yaml" }//-- empty; decodes to nothing
+	return format
+}//-- end func sniffFormat
+
+// Decodes TOML; if strict, keys matching no field are errors
+type tomlDecoder struct {
+	file io.Reader
+	strict bool
+}//-- end tomlDecoder struct
+
+func (dec *tomlDecoder) Decode (v interface{}) error {
+	meta, err := toml.NewDecoder(dec.file).Decode(v)
+	if err != nil { return err }
+	if undecoded := meta.Undecoded(); dec.strict && len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded { keys[i] = key.String() }
+		return fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}//-- end func tomlDecoder.Decode
+
+type hclDecoder struct {
+	file io.Reader
+}//-- end hclDecoder struct
+
+func (dec *hclDecoder) Decode (v interface{}) error {
+	content, err := ioutil.ReadAll(dec.file)
+	if err != nil { return err }
+	return decodeReplacingLists(v, func (v interface{}) error {
+		return hcl.Decode(v, string(content))
+	})
+}//-- end func hclDecoder.Decode
+
+// Decodes XML. Like hcl, encoding/xml appends to slices rather than
+// replacing them; see decodeReplacingLists.
+type xmlDecoder struct {
+	content []byte
+}//-- end xmlDecoder struct
+
+func (dec *xmlDecoder) Decode (v interface{}) error {
+	return decodeReplacingLists(v, func (v interface{}) error {
+		return xml.NewTokenDecoder(&lowercaseTokens{xml.NewDecoder(
+			bytes.NewReader(dec.content))}).Decode(v)
+	})
+}//-- end func xmlDecoder.Decode
+
+// Decodes into v, which may already hold values, replacing the lists the
+// document sets. Where decode would append to them, an overlay would
+// otherwise extend the lists of the layers beneath it, rather than
+// replace them as the other formats do; so the document is first decoded
+// into a zero value, and the lists set there emptied in v.
+func decodeReplacingLists (v interface{},
+		decode func (interface{}) error) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr { return decode(v) }
+	probe := reflect.New(target.Elem().Type())
+	if err := decode(probe.Interface()); err != nil { return err }
+	clearSetLists(target.Elem(), probe.Elem())
+	return decode(v)
+}//-- end func decodeReplacingLists
+
+// Empties each list of val that is non-empty in set, recursing into
+// structs
+func clearSetLists (val, set reflect.Value) {
+	switch (val.Kind()) {
+		case reflect.Slice:
+			if set.Len() > 0 && val.CanSet() {
+				val.Set(reflect.Zero(val.Type()))
+			}
+		case reflect.Struct:
+			for i := 0; i < val.NumField(); i++ {
+				clearSetLists(val.Field(i), set.Field(i))
+			}
+	}//-- end switch
+}//-- end func clearSetLists
+
+// Lowercases element names, so XML configs match the struct tags
+// regardless of case
+type lowercaseTokens struct {
+	dec *xml.Decoder
+}//-- end lowercaseTokens struct
+
+func (lt *lowercaseTokens) Token () (xml.Token, error) {
+	tok, err := lt.dec.Token()
+	switch t := tok.(type) {
+		case xml.StartElement:
+			t.Name.Local = strings.ToLower(t.Name.Local)
+			return t, err
+		case xml.EndElement:
+			t.Name.Local = strings.ToLower(t.Name.Local)
+			return t, err
+	}//-- end switch
+	return tok, err
+}//-- end func lowercaseTokens.Token
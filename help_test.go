@@ -0,0 +1,30 @@
+package webapp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Every built-in setting must be described, and every description must
+// belong to a setting.
+func TestConfigHelp (t *testing.T) {
+	described := make(map[string]bool)
+	var walk func (typ reflect.Type, parent string)
+	walk = func (typ reflect.Type, parent string) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			key := configKey(field)
+			if key == "" { continue }
+			path := keyPath(parent, key)
+			if configHelp[path] == "" { t.Errorf("%s lacks help", path) }
+			described[path] = true
+			if field.Type.Kind() == reflect.Struct && field.Type != timeType {
+				walk(field.Type, path)
+			}
+		}//-- end for range fields
+	}//-- end func walk
+	walk(reflect.TypeOf(Config{}), "")
+	for path := range configHelp {
+		if !described[path] { t.Errorf("help for unknown setting %s", path) }
+	}
+}//-- end TestConfigHelp
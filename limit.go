@@ -0,0 +1,203 @@
+package webapp
+
+/**
+ * Connection limiting and load shedding for DefaultServer. Connections
+ * beyond MaxConns wait in the kernel's accept backlog; requests beyond
+ * MaxInFlight wait in a bounded FIFO queue, and anything beyond
+ * MaxQueued (or waiting longer than QueueTimeoutSecs) is rejected at
+ * once with 503 Service Unavailable. A limit of zero means unlimited,
+ * but current counts are tracked regardless.
+ */
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot of the server's load, as returned by DefaultServer.Stats
+type ServerStats struct {
+	ActiveConns int64
+	InFlight int
+	Queued int
+	Rejected uint64
+}//-- end ServerStats struct
+
+// Counts a server's open connections, holding a slot for each while
+// below max. Created with the server, so that Stats may read it while
+// Serve is still starting.
+type connLimit struct {
+	active int64//-- first, for 64-bit alignment
+	slots chan struct{}//-- nil if unlimited
+}//-- end connLimit struct
+
+func newConnLimit (max int) *connLimit {
+	lim := new(connLimit)
+	if max > 0 { lim.slots = make(chan struct{}, max) }
+	return lim
+}//-- end func newConnLimit
+
+func (lim *connLimit) Active () int64 {
+	if lim == nil { return 0 }
+	return atomic.LoadInt64(&lim.active)
+}//-- end func connLimit.Active
+
+// Accepts connections only while lim has a free slot. While all are
+// taken, Accept waits for one, or for Close.
+type limitListener struct {
+	net.Listener
+	lim *connLimit
+	closed chan struct{}
+	once sync.Once
+}//-- end limitListener struct
+
+func newLimitListener (ln net.Listener, lim *connLimit) *limitListener {
+	return &limitListener{Listener: ln, lim: lim,
+		closed: make(chan struct{})}
+}//-- end func newLimitListener
+
+func (ln *limitListener) Accept () (net.Conn, error) {
+	if ln.lim.slots != nil {
+		select {
+			case ln.lim.slots <- struct{}{}:
+			case <-ln.closed:
+				return nil, net.ErrClosed
+		}//-- end select
+	}
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		if ln.lim.slots != nil { <-ln.lim.slots }
+		return nil, err
+	}
+	atomic.AddInt64(&ln.lim.active, 1)
+	return &limitConn{Conn: conn, lim: ln.lim}, nil
+}//-- end func limitListener.Accept
+
+func (ln *limitListener) Close () error {
+	ln.once.Do(func() { close(ln.closed) })
+	return ln.Listener.Close()
+}//-- end func limitListener.Close
+
+type limitConn struct {
+	net.Conn
+	lim *connLimit
+	once sync.Once
+}//-- end limitConn struct
+
+func (conn *limitConn) Close () error {
+	err := conn.Conn.Close()
+	conn.once.Do(func() {
+		atomic.AddInt64(&conn.lim.active, -1)
+		if conn.lim.slots != nil { <-conn.lim.slots }
+	})
+	return err
+}//-- end func limitConn.Close
+
+// Admits up to maxInFlight concurrent requests, queueing up to maxQueued
+// more in arrival order.
+type requestLimiter struct {
+	maxInFlight, maxQueued int
+	timeout time.Duration//-- zero waits as long as the client does
+	inFlight int
+	waiters []chan struct{}
+	rejected uint64
+	mut sync.Mutex
+}//-- end requestLimiter struct
+
+func (lim *requestLimiter) SetLimits (maxInFlight, maxQueued int,
+		timeout time.Duration) {
+	lim.mut.Lock()
+	defer lim.mut.Unlock()
+	lim.maxInFlight, lim.maxQueued, lim.timeout = maxInFlight, maxQueued,
+		timeout
+	lim.admitWaiters()
+}//-- end func requestLimiter.SetLimits
+
+func (lim *requestLimiter) hasRoom () bool {
+	return lim.maxInFlight <= 0 || lim.inFlight < lim.maxInFlight
+}//-- end func requestLimiter.hasRoom
+
+// Hands free slots to queued requests; caller must hold mut.
+func (lim *requestLimiter) admitWaiters () {
+	for len(lim.waiters) > 0 && lim.hasRoom() {
+		lim.inFlight++
+		close(lim.waiters[0])
+		lim.waiters = lim.waiters[1:]
+	}//-- end for
+}//-- end func requestLimiter.admitWaiters
+
+// Returns true once the request may proceed, in which case the caller
+// must later call release; false if the request was shed.
+func (lim *requestLimiter) acquire (r *http.Request) bool {
+	lim.mut.Lock()
+	if len(lim.waiters) == 0 && lim.hasRoom() {
+		lim.inFlight++
+		lim.mut.Unlock()
+		return true
+	}
+	if len(lim.waiters) >= lim.maxQueued {
+		lim.rejected++
+		lim.mut.Unlock()
+		return false
+	}
+	admitted := make(chan struct{})
+	lim.waiters = append(lim.waiters, admitted)
+	var expired <-chan time.Time
+	if lim.timeout > 0 {
+		timer := time.NewTimer(lim.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	lim.mut.Unlock()
+	select {
+		case <-admitted:
+			return true
+		case <-expired:
+		case <-r.Context().Done():
+	}//-- end select
+	lim.mut.Lock()
+	defer lim.mut.Unlock()
+	for i, waiter := range lim.waiters {
+		if waiter == admitted {
+			lim.waiters = append(lim.waiters[:i], lim.waiters[i + 1:]...)
+			lim.rejected++
+			return false
+		}
+	}//-- end for range lim.waiters
+	return true//-- admitted while giving up; the slot is ours
+}//-- end func requestLimiter.acquire
+
+func (lim *requestLimiter) release () {
+	lim.mut.Lock()
+	defer lim.mut.Unlock()
+	lim.inFlight--
+	lim.admitWaiters()
+}//-- end func requestLimiter.release
+
+func (lim *requestLimiter) counts () (inFlight, queued int,
+		rejected uint64) {
+	lim.mut.Lock()
+	defer lim.mut.Unlock()
+	return lim.inFlight, len(lim.waiters), lim.rejected
+}//-- end func requestLimiter.counts
+
+func makeLimitHandler (next http.Handler,
+		lim *requestLimiter) http.HandlerFunc {
+	return func (w http.ResponseWriter, r *http.Request) {
+		if !lim.acquire(r) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+			return
+		}
+		defer lim.release()
+		next.ServeHTTP(w, r)
+	}//-- end return
+}//-- end func makeLimitHandler
+
+func (svr *DefaultServer) Stats () ServerStats {
+	stats := ServerStats{ActiveConns: svr.conns.Active()}
+	stats.InFlight, stats.Queued, stats.Rejected = svr.limiter.counts()
+	return stats
+}//-- end func DefaultServer.Stats
@@ -0,0 +1,103 @@
+package webapp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimitListener (t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	lim := newConnLimit(1)
+	ln := newLimitListener(inner, lim)
+	for i := 0; i < 3; i++ {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil { t.Fatal(err) }
+		defer client.Close()
+	}//-- end for
+	conn, err := ln.Accept()
+	if err != nil { t.Fatal(err) }
+	if lim.Active() != 1 { t.Errorf("%d active, want 1", lim.Active()) }
+	accepted := make(chan error)
+	go func () {
+		conn, err := ln.Accept()
+		if err == nil { conn.Close() }
+		accepted <- err
+	}()
+	select {
+		case <-accepted:
+			t.Fatal("accepted beyond the limit")
+		case <-time.After(50 * time.Millisecond):
+	}//-- end select
+	conn.Close()
+	conn.Close()//-- frees the slot only once
+	if err = <-accepted; err != nil { t.Fatal(err) }
+	if lim.Active() != 0 { t.Errorf("%d active, want 0", lim.Active()) }
+	//-- with every slot taken, Close must interrupt a waiting Accept
+	if conn, err = ln.Accept(); err != nil { t.Fatal(err) }
+	defer conn.Close()
+	go func () {
+		_, err := ln.Accept()
+		accepted <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ln.Close()
+	select {
+		case err = <-accepted:
+			if err == nil { t.Error("Accept succeeded after Close") }
+		case <-time.After(time.Second):
+			t.Fatal("Close did not interrupt Accept")
+	}//-- end select
+}//-- end TestLimitListener
+
+func TestRequestLimiter (t *testing.T) {
+	lim := new(requestLimiter)
+	lim.SetLimits(1, 1, 100 * time.Millisecond)
+	unblock := make(chan struct{})
+	handler := makeLimitHandler(http.HandlerFunc(
+		func (w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" { <-unblock }
+		}), lim)
+	serve := func (path string) chan int {
+		status := make(chan int, 1)
+		go func () {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("GET", path, nil))
+			status <- rec.Code
+		}()
+		return status
+	}//-- end func serve
+	waitFor := func (inFlight, queued int) {
+		for i := 0; i < 100; i++ {
+			if in, q, _ := lim.counts(); in == inFlight && q == queued {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}//-- end for
+		t.Fatalf("never reached %d in flight, %d queued", inFlight, queued)
+	}//-- end func waitFor
+	slow := serve("/slow")
+	waitFor(1, 0)
+	queued := serve("/fast")
+	waitFor(1, 1)
+	if status := <-serve("/fast"); status != http.StatusServiceUnavailable {
+		t.Errorf("got %d beyond the queue, want 503", status)
+	}
+	if status := <-queued; status != http.StatusServiceUnavailable {
+		t.Errorf("got %d after the queue timeout, want 503", status)
+	}
+	queued = serve("/fast")
+	waitFor(1, 1)
+	close(unblock)
+	for _, status := range []chan int{slow, queued} {
+		if code := <-status; code != http.StatusOK {
+			t.Errorf("got %d, want 200", code)
+		}
+	}//-- end for range statuses
+	if in, q, rejected := lim.counts(); in != 0 || q != 0 || rejected != 2 {
+		t.Errorf("counts %d, %d, %d; want 0, 0, 2", in, q, rejected)
+	}
+}//-- end TestRequestLimiter
@@ -0,0 +1,53 @@
+package webapp
+
+/**
+ * Minimal leveled logging on top of the standard log package. The level
+ * is process-wide and may be changed at runtime (see admin.go).
+ */
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)//-- end LogLevel enums
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+var currentLogLevel int32 = int32(LogInfo)
+
+func (lvl LogLevel) String () string {
+	if lvl < LogDebug || lvl > LogError { return fmt.Sprintf("%d", lvl) }
+	return logLevelNames[lvl]
+}//-- end func LogLevel.String
+
+func ParseLogLevel (name string) (LogLevel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" { name = "warn" }
+	for i, lvlName := range logLevelNames {
+		if name == lvlName { return LogLevel(i), nil }
+	}
+	return LogInfo, fmt.Errorf(`Invalid log level "%s"`, name)
+}//-- end func ParseLogLevel
+
+func SetLogLevel (lvl LogLevel) {
+	atomic.StoreInt32(&currentLogLevel, int32(lvl))
+}//-- end func SetLogLevel
+
+func GetLogLevel () LogLevel {
+	return LogLevel(atomic.LoadInt32(&currentLogLevel))
+}//-- end func GetLogLevel
+
+func logf (lvl LogLevel, format string, a ...interface{}) {
+	if lvl < GetLogLevel() { return }
+	log.Printf(format, a...)
+}//-- end func logf
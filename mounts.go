@@ -0,0 +1,266 @@
+package webapp
+
+/**
+ * Static mounts. Besides the root mount described by the StaticDir/
+ * StaticFS fields of ServerConfig, any number of directories may be
+ * mounted beneath URL prefixes (e.g. "/uploads"), each with its own
+ * caching, SPA and listing settings. Requests go to the mount with the
+ * longest matching prefix. All mounts share one memory budget and
+ * refresh interval.
+ *
+ * Mounts with Listing set answer requests for directories lacking an
+ * index with a listing of their contents, as an HTML page or JSON.
+ * Dotfiles, e.g. ".env", are neither listed nor served, by any mount;
+ * /.well-known alone is exempt.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type StaticMount struct {
+	// URL path, e.g. "/uploads"
+	Prefix string `json:"prefix" xml:"prefix" toml:"prefix" reload:"no"`
+	Dir string `json:"dir" xml:"dir" toml:"dir" reload:"no"`
+	// used instead of Dir if set
+	FS fs.FS `json:"-" xml:"-" yaml:"-" toml:"-" reload:"no"`
+	// defaults to "index.html"
+	Index string `json:"index" xml:"index" toml:"index"`
+	CacheTimeoutSecs int `json:"cachetimeoutsecs" xml:"cachetimeoutsecs" toml:"cachetimeoutsecs"`
+	CacheRules []CacheRule `json:"cacherules" xml:"cacherules" toml:"cacherules"`
+	SPAFallback bool `json:"spafallback" xml:"spafallback" toml:"spafallback"`
+	// relative to Prefix
+	SPAExcludePrefixes []string `json:"spaexcludeprefixes" xml:"spaexcludeprefixes" toml:"spaexcludeprefixes"`
+	Fingerprint bool `json:"fingerprint" xml:"fingerprint" toml:"fingerprint" reload:"no"`
+	// "", "html" or "json"
+	Listing string `json:"listing" xml:"listing" toml:"listing"`
+}//-- end StaticMount struct
+
+func (mount *StaticMount) Validate () error {
+	if !strings.HasPrefix(mount.Prefix, "/") {
+		return fmt.Errorf(`Static mount prefix "%s" must begin with "/"`,
+			mount.Prefix)
+	}
+	if mount.Dir == "" && mount.FS == nil {
+		return fmt.Errorf(`No Dir or FS provided to static mount "%s"`,
+			mount.Prefix)
+	}
+	switch (mount.Listing) {
+		case "", "html", "json":
+		default:
+			return fmt.Errorf(`Invalid listing "%s" for static mount "%s"`,
+				mount.Listing, mount.Prefix)
+	}//-- end switch
+	for _, rule := range mount.CacheRules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf(`Invalid cache rule pattern "%s"`, rule.Pattern)
+		}
+	}
+	return nil
+}//-- end func StaticMount.Validate
+
+// The mount described by the top-level static fields, if any
+func (cfg *ServerConfig) rootMount () (StaticMount, bool) {
+	if cfg.StaticDir == "" && cfg.StaticFS == nil { return StaticMount{}, false }
+	return StaticMount{Prefix: "/", Dir: cfg.StaticDir, FS: cfg.StaticFS,
+		Index: cfg.Index, CacheTimeoutSecs: cfg.CacheTimeoutSecs,
+		CacheRules: cfg.CacheRules, SPAFallback: cfg.SPAFallback,
+		SPAExcludePrefixes: cfg.SPAExcludePrefixes,
+		Fingerprint: cfg.Fingerprint, Listing: cfg.StaticListing}, true
+}//-- end func ServerConfig.rootMount
+
+// Every mount to be served, the root mount first
+func (cfg *ServerConfig) staticMounts () []StaticMount {
+	mounts := make([]StaticMount, 0, len(cfg.StaticMounts) + 1)
+	if root, exists := cfg.rootMount(); exists { mounts = append(mounts, root) }
+	return append(mounts, cfg.StaticMounts...)
+}//-- end func ServerConfig.staticMounts
+
+func (cfg *ServerConfig) validateMounts () error {
+	mounts := cfg.staticMounts()
+	if len(mounts) == 0 {
+		return errors.New("No StaticDir, StaticFS or StaticMounts provided " +
+			"to ServerConfig")
+	}
+	var errs ConfigErrors
+	seen := make(map[string]bool)
+	for i := range mounts {
+		errs.Add(mounts[i].Validate())
+		prefix := mountPrefix(mounts[i].Prefix)
+		if seen[prefix] {
+			errs.Add(fmt.Errorf(`Duplicate static mount prefix "%s"`, prefix))
+		}
+		seen[prefix] = true
+	}
+	return errs.Err()
+}//-- end func ServerConfig.validateMounts
+
+// "/uploads/" -> "/uploads"; "/" is kept as is
+func mountPrefix (prefix string) string {
+	if prefix == "/" { return prefix }
+	return "/" + strings.Trim(prefix, "/")
+}//-- end func mountPrefix
+
+type staticMount struct {
+	StaticMount//-- as first loaded; see settings
+	live atomic.Value//-- *StaticMount, as last reconfigured
+	files *handlerMap
+	serve cachedStaticServer
+}//-- end staticMount struct
+
+func (mount *staticMount) settings () *StaticMount {
+	return mount.live.Load().(*StaticMount)
+}//-- end func staticMount.settings
+
+// Applies the reloadable settings of conf
+func (mount *staticMount) reconfigure (conf StaticMount) {
+	conf.Prefix = mount.Prefix
+	mount.live.Store(&conf)
+}//-- end func staticMount.reconfigure
+
+// Returns the path of r relative to the mount, and whether it lies
+// beneath the mount at all.
+func (mount *staticMount) relative (urlPath string) (string, bool) {
+	if mount.Prefix == "/" { return urlPath, true }
+	if urlPath == mount.Prefix { return "/", true }
+	if !strings.HasPrefix(urlPath, mount.Prefix + "/") { return "", false }
+	return strings.TrimPrefix(urlPath, mount.Prefix), true
+}//-- end func staticMount.relative
+
+// Returns the mount with the longest prefix covering urlPath, if any,
+// and urlPath relative to it.
+func findMount (mounts []*staticMount, urlPath string) (*staticMount,
+		string) {
+	var found *staticMount
+	var rel string
+	for _, mount := range mounts {
+		if found != nil && len(found.Prefix) >= len(mount.Prefix) { continue }
+		if relPath, ok := mount.relative(urlPath); ok {
+			found, rel = mount, relPath
+		}
+	}//-- end for range mounts
+	return found, rel
+}//-- end func findMount
+
+// Loads every mount configured in cfg, returning a server dispatching
+// between them.
+func makeStaticServer (cfg *ServerConfig) (cachedStaticServer,
+		[]*staticMount) {
+	cache := newStaticCache(cfg.StaticStreamThreshold,
+		cfg.StaticCacheMaxBytes)
+	var mounts []*staticMount
+	for _, conf := range cfg.staticMounts() {
+		mount := &staticMount{StaticMount: conf, files: initHandlerMap()}
+		mount.Prefix = mountPrefix(mount.Prefix)
+		mount.files.cache = cache
+		mount.files.fingerprint = mount.Fingerprint
+		var err error
+		if mount.FS != nil {
+			err = mount.files.LoadFS(mount.FS, "")
+		} else {
+			err = mount.files.LoadFiles(mount.Dir)
+		}
+		if err != nil { log.Print(err.Error()) }
+		if cfg.StaticCacheRefreshSecs > 0 {
+			mount.files.Watch(time.Duration(cfg.StaticCacheRefreshSecs) *
+				time.Second, cfg.StaticPollOnly)
+		}
+		mount.reconfigure(mount.StaticMount)
+		mount.serve = makeMountServer(mount)
+		mounts = append(mounts, mount)
+	}//-- end for range mounts
+	return func (w http.ResponseWriter, r *http.Request) {
+		mount, rel := findMount(mounts, r.URL.Path)
+		if mount == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if rel != r.URL.Path {
+			//-- as http.StripPrefix
+			stripped := new(http.Request)
+			*stripped = *r
+			stripped.URL = new(url.URL)
+			*stripped.URL = *r.URL
+			stripped.URL.Path, stripped.URL.RawPath = rel, ""
+			r = stripped
+		}
+		mount.serve(w, r)
+	}, mounts
+}//-- end func makeStaticServer
+
+type listingEntry struct {
+	Name string `json:"name"`
+	Size int64 `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Dir bool `json:"dir"`
+}//-- end listingEntry struct
+
+// Writes a listing of the directory at r's (mount-relative) path, if it
+// is one. Dotfiles are left out, as hiddenPath refuses to serve them.
+func serveListing (w http.ResponseWriter, r *http.Request,
+		mount *StaticMount, handlers *handlerMap) bool {
+	handlers.mut.RLock()
+	fsys := handlers.fsys
+	handlers.mut.RUnlock()
+	if fsys == nil { return false }
+	name := strings.Trim(path.Clean(r.URL.Path), "/")
+	if name == "" { name = "." }
+	dirents, err := fs.ReadDir(fsys, name)
+	if err != nil { return false }
+	entries := make([]listingEntry, 0, len(dirents))
+	for _, dirent := range dirents {
+		if hiddenPath(dirent.Name()) { continue }
+		info, err := dirent.Info()
+		if err != nil { continue }
+		entry := listingEntry{Name: dirent.Name(), ModTime: info.ModTime(),
+			Dir: dirent.IsDir()}
+		if !entry.Dir { entry.Size = info.Size() }
+		entries = append(entries, entry)
+	}//-- end for range dirents
+	sort.Slice(entries, func (i, j int) bool {
+		if entries[i].Dir != entries[j].Dir { return entries[i].Dir }
+		return entries[i].Name < entries[j].Name
+	})
+	w.Header().Set("Cache-Control", "no-cache")
+	if mount.Listing == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return true
+	}
+	base := path.Join(mount.Prefix, "/" + name)
+	if !strings.HasSuffix(base, "/") { base += "/" }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%s</title></head>" +
+		"<body>\n<h1>%s</h1>\n<table>\n", html.EscapeString(base),
+		html.EscapeString(base))
+	if base != mount.Prefix && base != mount.Prefix + "/" {
+		fmt.Fprintf(w, "<tr><td><a href=\"%s\">../</a></td></tr>\n",
+			html.EscapeString(path.Dir(strings.TrimSuffix(base, "/")) + "/"))
+	}
+	for _, entry := range entries {
+		href, label, size := base + url.PathEscape(entry.Name), entry.Name, "-"
+		if entry.Dir {
+			href, label = href + "/", label + "/"
+		} else {
+			size = fmt.Sprint(entry.Size)
+		}
+		fmt.Fprintf(w, "<tr><td><a href=\"%s\">%s</a></td><td>%s</td>" +
+			"<td>%s</td></tr>\n", html.EscapeString(href),
+			html.EscapeString(label), size,
+			entry.ModTime.UTC().Format(time.RFC1123))
+	}//-- end for range entries
+	fmt.Fprint(w, "</table>\n</body></html>\n")
+	return true
+}//-- end func serveListing
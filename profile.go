@@ -0,0 +1,153 @@
+package webapp
+
+/**
+ * Layered configuration. The defaults (see defaults.go) are overlaid by a
+ * base file (config.yml), then by the file for the selected profile
+ * (config.production.yml), then by an untracked config.local.yml, each
+ * decoded in turn into the same Config; missing overlays are skipped.
+ * The merge rules follow from that:
+ *   - a field absent from an overlay keeps its earlier value
+ *   - nested structs are merged field by field
+ *   - lists are replaced whole, in every format (see
+ *     decodeReplacingLists)
+ *   - maps are merged key by key
+ * Environment overrides (see env.go) are applied next, then any
+ * command-line flags (see flags.go), then secret references resolved
+ * (see secrets.go), and finally the result validated, every problem
+ * reported at once (see Config.Validate).
+ */
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	// imported packages
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// name of the overlay applied after every profile
+const localProfile = "local"
+
+// Filename standing for stdin
+const stdinName = "-"
+
+type ConfigLoader struct {
+	Filename string//-- the base file; "-" reads stdin, with no overlays
+	Profile string//-- e.g. "production"; empty applies no profile overlay
+	SkipEnv bool//-- don't apply environment overrides
+	Lenient bool//-- ignore unknown keys, rather than failing
+	// leave Config.Validate to the caller, e.g. to set Server.StaticFS
+	// first
+	SkipValidate bool
+	loaded []string
+	flags []flagArg//-- see LoadArgs
+}//-- end ConfigLoader struct
+
+// Returns the path of filename's overlay for profile: config.yml ->
+// config.production.yml
+func overlayName (filename, profile string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "." + profile + ext
+}//-- end func overlayName
+
+// Files to be decoded, in order
+func (ld *ConfigLoader) layers () []string {
+	layers := []string{ld.Filename}
+	if ld.Filename == stdinName { return layers }
+	if ld.Profile != "" && ld.Profile != localProfile {
+		layers = append(layers, overlayName(ld.Filename, ld.Profile))
+	}
+	return append(layers, overlayName(ld.Filename, localProfile))
+}//-- end func ConfigLoader.layers
+
+// Decodes filename into config, on top of its current values
+func decodeConfigFile (filename string, config *Config, strict bool) error {
+	file := os.Stdin
+	if filename != stdinName {
+		var err error
+		if file, err = os.Open(filename); err != nil { return err }
+		defer file.Close()
+	}
+	dec, err := getDecoder(file, formatOf(filename), strict)
+	if err != nil { return err }
+	err = config.decodeFrom(dec)
+	if err != nil && err != io.EOF {//-- an empty overlay is no error
+		return fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return nil
+}//-- end func decodeConfigFile
+
+// Loads and validates the config, reporting every problem found at once
+// (see Config.Validate), unless SkipValidate is set.
+func (ld *ConfigLoader) Load () (*Config, error) {
+	return ld.load(!ld.SkipValidate)
+}//-- end func ConfigLoader.Load
+
+func (ld *ConfigLoader) load (validate bool) (*Config, error) {
+	config := DefaultConfig()
+	ld.loaded = nil
+	for i, filename := range ld.layers() {
+		err := decodeConfigFile(filename, config, !ld.Lenient)
+		if i > 0 && os.IsNotExist(err) { continue }
+		if err != nil { return nil, err }
+		ld.loaded = append(ld.loaded, filename)
+	}//-- end for range layers
+	if err := ld.finish(config, validate); err != nil { return nil, err }
+	return config, nil
+}//-- end func ConfigLoader.load
+
+// Applies environment overrides, then flags, resolves secrets and, if
+// validate is set, validates, once decoded
+func (ld *ConfigLoader) finish (config *Config, validate bool) error {
+	if !ld.SkipEnv {
+		if err := config.ApplyEnv(EnvPrefix); err != nil { return err }
+	}
+	if err := ld.applyFlags(config); err != nil { return err }
+	if err := config.ResolveSecrets(); err != nil { return err }
+	if !validate { return nil }
+	return config.Validate()
+}//-- end func ConfigLoader.finish
+
+// Returns the files merged by the last Load, base file first
+func (ld *ConfigLoader) Files () []string {
+	return append([]string(nil), ld.loaded...)
+}//-- end func ConfigLoader.Files
+
+// Loads filename overlaid by the files for profile; see ConfigLoader.
+func LoadConfigProfile (filename, profile string) (*Config, error) {
+	loader := &ConfigLoader{Filename: filename, Profile: profile}
+	return loader.Load()
+}//-- end func LoadConfigProfile
+
+// Writes the config in the given format ("json", "xml", "yaml" or
+// "toml"), e.g. to inspect the result of merging profiles. Secrets are
+// redacted.
+func (cfg *Config) Encode (w io.Writer, format string) error {
+	doc := cfg.Redacted().encodable()
+	switch (format) {
+		case "json":
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "\t")
+			return enc.Encode(doc)
+		case "xml":
+			enc := xml.NewEncoder(w)
+			enc.Indent("", "\t")
+			root := xml.StartElement{Name: xml.Name{Local: "Config"}}
+			if err := enc.EncodeElement(doc, root); err != nil { return err }
+			_, err := io.WriteString(w, "\n")
+			return err
+		case "yaml", "yml":
+			enc := yaml.NewEncoder(w)
+			defer enc.Close()
+			return enc.Encode(doc)
+		case "toml":
+			return toml.NewEncoder(w).Encode(doc)
+		default:
+			return fmt.Errorf(`Invalid file type "%s"`, format)
+	}//-- end switch
+}//-- end func Config.Encode
@@ -0,0 +1,92 @@
+package webapp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigProfiles (t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yml": "index: index.html\nwaitsecs: 5\n" +
+			"server:\n  port: \":8080\"\n  staticdir: static\n" +
+			"  trustedproxies: [10.0.0.0/8, 127.0.0.1]\n" +
+			"database:\n  username: dev\n  password: dev\n",
+		"config.production.yml": "server:\n  port: \":80\"\n" +
+			"  trustedproxies: [192.168.0.0/16]\n" +
+			"database:\n  username: prod\n",
+		"config.local.yml": "database:\n  password: local\n",
+		"config.staging.yml": ""}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil { t.Fatal(err) }
+	}
+	base := filepath.Join(dir, "config.yml")
+	loader := &ConfigLoader{Filename: base, Profile: "production",
+		SkipEnv: true, SkipValidate: true}
+	cfg, err := loader.Load()
+	if err != nil { t.Fatal(err) }
+	if cfg.Index != "index.html" || cfg.WaitSecs != 5 ||
+			cfg.Server.Port != ":80" || cfg.Server.StaticDir != "static" ||
+			len(cfg.Server.TrustedProxies) != 1 ||
+			cfg.Database.Username != "prod" || cfg.Database.Password != "local" {
+		t.Errorf("unexpected merge: %+v", cfg)
+	}
+	if got := loader.Files(); len(got) != 3 {
+		t.Errorf("loaded %v", got)
+	}
+	for _, profile := range []string{"", "staging", "missing"} {
+		loader = &ConfigLoader{Filename: base, Profile: profile, SkipEnv: true,
+			SkipValidate: true}
+		cfg, err = loader.Load()
+		if err != nil { t.Fatalf("%s: %s", profile, err.Error()) }
+		if cfg.Server.Port != ":8080" || cfg.Database.Password != "local" {
+			t.Errorf("%s: unexpected merge: %+v", profile, cfg)
+		}
+	}//-- end for range profiles
+	out := bytes.Buffer{}
+	if err = cfg.Encode(&out, "yaml"); err != nil { t.Fatal(err) }
+	if !strings.Contains(out.String(), "username: dev") ||
+			strings.Contains(out.String(), "password: local") {
+		t.Errorf("unexpected encoding:\n%s", out.String())
+	}
+}//-- end TestConfigProfiles
+
+func TestConfigOverlayLists (t *testing.T) {
+	sources := map[string][2]string{
+		"json": {`{"server": {"trustedproxies": ["10.0.0.0/8", "127.0.0.1"]}}`,
+			`{"server": {"trustedproxies": ["192.168.0.0/16"]}}`},
+		"xml": {"<config><server><trustedproxies>10.0.0.0/8</trustedproxies>" +
+			"<trustedproxies>127.0.0.1</trustedproxies></server></config>",
+			"<config><server><trustedproxies>192.168.0.0/16</trustedproxies>" +
+			"</server></config>"},
+		"yaml": {"server:\n  trustedproxies: [10.0.0.0/8, 127.0.0.1]\n",
+			"server:\n  trustedproxies: [192.168.0.0/16]\n"},
+		"toml": {"[server]\ntrustedproxies = [\"10.0.0.0/8\", \"127.0.0.1\"]\n",
+			"[server]\ntrustedproxies = [\"192.168.0.0/16\"]\n"},
+		"hcl": {"server {\n  trustedproxies = [\"10.0.0.0/8\", \"127.0.0.1\"]\n}\n",
+			"server {\n  trustedproxies = [\"192.168.0.0/16\"]\n}\n"}}
+	for format, layers := range sources {
+		dir := t.TempDir()
+		base := filepath.Join(dir, "config." + format)
+		err := ioutil.WriteFile(base, []byte(layers[0]), 0644)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "config.production." +
+				format), []byte(layers[1]), 0644)
+		}
+		if err != nil { t.Fatal(err) }
+		cfg, err := (&ConfigLoader{Filename: base, Profile: "production",
+			SkipEnv: true, Lenient: true, SkipValidate: true}).Load()
+		if err != nil {
+			t.Errorf("%s: %s", format, err.Error())
+			continue
+		}
+		if got := cfg.Server.TrustedProxies; len(got) != 1 ||
+				got[0] != "192.168.0.0/16" {
+			t.Errorf("%s: got trusted proxies %v", format, got)
+		}
+	}//-- end for range sources
+}//-- end TestConfigOverlayLists
@@ -0,0 +1,305 @@
+package webapp
+
+/**
+ * Support for running behind reverse proxies and load balancers.
+ * Requests arriving from a trusted proxy have their client address,
+ * scheme and host rewritten from the Forwarded or X-Forwarded-* headers;
+ * optionally, connections are expected to open with a PROXY protocol
+ * (v1 or v2) header carrying the original source address.
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maximum time a connection may take to send its PROXY header
+const proxyHeaderTimeout = 5 * time.Second
+
+type trustedProxies []*net.IPNet
+
+// Parses a list of CIDR ranges or bare IP addresses.
+func parseTrustedProxies (addrs []string) (trustedProxies, error) {
+	nets := make(trustedProxies, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf(`Invalid trusted proxy "%s"`, addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil { ip, bits = ip.To4(), 8 * net.IPv4len }
+			nets = append(nets, &net.IPNet{IP: ip,
+				Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, fmt.Errorf(`Invalid trusted proxy "%s"`, addr)
+		}
+		nets = append(nets, ipNet)
+	}//-- end for range addrs
+	return nets, nil
+}//-- end func parseTrustedProxies
+
+func (tp trustedProxies) contains (ip net.IP) bool {
+	if ip == nil { return false }
+	for _, ipNet := range tp {
+		if ipNet.Contains(ip) { return true }
+	}
+	return false
+}//-- end func trustedProxies.contains
+
+func (tp trustedProxies) containsAddr (addr net.Addr) bool {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok { return tp.contains(tcpAddr.IP) }
+	return tp.contains(hostIP(addr.String()))
+}//-- end func trustedProxies.containsAddr
+
+// Returns the IP portion of a "host:port" or bare host string, or nil.
+func hostIP (addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil { addr = host }
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["),
+		"]"))
+}//-- end func hostIP
+
+// a single proxy hop, as recorded in Forwarded or X-Forwarded-*
+type forwardedHop struct {
+	For, Proto, Host string
+}//-- end forwardedHop struct
+
+// Parses every Forwarded header value (RFC 7239) into hops, in order.
+func parseForwarded (values []string) []forwardedHop {
+	hops := make([]forwardedHop, 0)
+	for _, value := range values {
+		for _, elem := range strings.Split(value, ",") {
+			hop := forwardedHop{}
+			for _, pair := range strings.Split(elem, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 { continue }
+				val := strings.Trim(kv[1], `"`)
+				switch (strings.ToLower(kv[0])) {
+					case "for":
+						hop.For = val
+					case "proto":
+						hop.Proto = strings.ToLower(val)
+					case "host":
+						hop.Host = val
+				}//-- end switch
+			}//-- end for range pairs
+			hops = append(hops, hop)
+		}//-- end for range elems
+	}//-- end for range values
+	return hops
+}//-- end func parseForwarded
+
+func splitHeaderList (values []string) []string {
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}//-- end func splitHeaderList
+
+// Converts X-Forwarded-For/-Proto/-Host into hops. Proto and Host are
+// matched to addresses by position when the lists line up; otherwise the
+// last value of each applies to every hop.
+func parseXForwarded (header http.Header) []forwardedHop {
+	addrs := splitHeaderList(header["X-Forwarded-For"])
+	protos := splitHeaderList(header["X-Forwarded-Proto"])
+	hosts := splitHeaderList(header["X-Forwarded-Host"])
+	hops := make([]forwardedHop, len(addrs))
+	for i, addr := range addrs {
+		hops[i].For = addr
+		if len(protos) == len(addrs) {
+			hops[i].Proto = strings.ToLower(protos[i])
+		} else if len(protos) > 0 {
+			hops[i].Proto = strings.ToLower(protos[len(protos) - 1])
+		}
+		if len(hosts) == len(addrs) {
+			hops[i].Host = hosts[i]
+		} else if len(hosts) > 0 {
+			hops[i].Host = hosts[len(hosts) - 1]
+		}
+	}//-- end for range addrs
+	return hops
+}//-- end func parseXForwarded
+
+// Walks the hops from the nearest proxy outwards, returning the first
+// hop not itself a trusted proxy (or the furthest hop, if all are
+// trusted). Returns false if a hop carries no usable address.
+func (tp trustedProxies) clientHop (hops []forwardedHop) (forwardedHop,
+		bool) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := hostIP(hops[i].For)
+		if ip == nil { return forwardedHop{}, false }
+		if i == 0 || !tp.contains(ip) { return hops[i], true }
+	}//-- end for i
+	return forwardedHop{}, false
+}//-- end func trustedProxies.clientHop
+
+// Rewrites RemoteAddr, Host and URL.Scheme of requests arriving from a
+// trusted proxy, preferring Forwarded over X-Forwarded-*.
+func makeProxyHandler (next http.Handler,
+		proxies trustedProxies) http.HandlerFunc {
+	return func (w http.ResponseWriter, r *http.Request) {
+		if !proxies.contains(hostIP(r.RemoteAddr)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var hops []forwardedHop
+		if values := r.Header["Forwarded"]; len(values) > 0 {
+			hops = parseForwarded(values)
+		} else {
+			hops = parseXForwarded(r.Header)
+		}
+		if hop, ok := proxies.clientHop(hops); ok {
+			port := "0"
+			if _, p, err := net.SplitHostPort(hop.For); err == nil { port = p }
+			r.RemoteAddr = net.JoinHostPort(hostIP(hop.For).String(), port)
+			if hop.Proto == "http" || hop.Proto == "https" {
+				r.URL.Scheme = hop.Proto
+			}
+			if hop.Host != "" { r.Host, r.URL.Host = hop.Host, hop.Host }
+		}
+		next.ServeHTTP(w, r)
+	}//-- end return
+}//-- end func makeProxyHandler
+
+// Listener whose connections begin with a PROXY protocol header. If
+// trusted is non-empty, only connections from those addresses are
+// expected to send one.
+type proxyListener struct {
+	net.Listener
+	trusted trustedProxies
+}//-- end proxyListener struct
+
+func (ln *proxyListener) Accept () (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil { return nil, err }
+	if len(ln.trusted) > 0 && !ln.trusted.containsAddr(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}//-- end func proxyListener.Accept
+
+// The header is parsed lazily, from the connection's own goroutine, so
+// that a slow client cannot stall Accept.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once sync.Once
+	srcAddr, dstAddr net.Addr
+	err error
+}//-- end proxyConn struct
+
+func (conn *proxyConn) init () {
+	conn.once.Do(func() {
+		conn.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		conn.srcAddr, conn.dstAddr, conn.err = readProxyHeader(conn.reader)
+		conn.Conn.SetReadDeadline(time.Time{})
+	})
+}//-- end func proxyConn.init
+
+func (conn *proxyConn) Read (b []byte) (int, error) {
+	conn.init()
+	if conn.err != nil { return 0, conn.err }
+	return conn.reader.Read(b)
+}//-- end func proxyConn.Read
+
+func (conn *proxyConn) RemoteAddr () net.Addr {
+	conn.init()
+	if conn.srcAddr != nil { return conn.srcAddr }
+	return conn.Conn.RemoteAddr()
+}//-- end func proxyConn.RemoteAddr
+
+func (conn *proxyConn) LocalAddr () net.Addr {
+	conn.init()
+	if conn.dstAddr != nil { return conn.dstAddr }
+	return conn.Conn.LocalAddr()
+}//-- end func proxyConn.LocalAddr
+
+var (
+	proxyV1Prefix = []byte("PROXY ")
+	proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	errNoProxyHeader = errors.New("connection missing PROXY protocol header")
+	errBadProxyHeader = errors.New("malformed PROXY protocol header")
+)//-- end var
+
+// Reads a v1 or v2 PROXY header. Returns nil addresses for headers that
+// carry no address (v1 UNKNOWN, v2 LOCAL or unsupported families).
+func readProxyHeader (reader *bufio.Reader) (src, dst net.Addr, err error) {
+	prefix, err := reader.Peek(len(proxyV1Prefix))
+	if err != nil { return nil, nil, errNoProxyHeader }
+	if bytes.Equal(prefix, proxyV1Prefix) { return readProxyV1(reader) }
+	prefix, err = reader.Peek(len(proxyV2Sig))
+	if err == nil && bytes.Equal(prefix, proxyV2Sig) {
+		return readProxyV2(reader)
+	}
+	return nil, nil, errNoProxyHeader
+}//-- end func readProxyHeader
+
+func readProxyV1 (reader *bufio.Reader) (src, dst net.Addr, err error) {
+	line := make([]byte, 0, 107)//-- max v1 header length
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == cap(line) { return nil, nil, errBadProxyHeader }
+		b, err := reader.ReadByte()
+		if err != nil { return nil, nil, errBadProxyHeader }
+		line = append(line, b)
+	}//-- end for
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" { return nil, nil, nil }
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, errBadProxyHeader
+	}
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, srcErr := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, dstErr := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || srcErr != nil || dstErr != nil {
+		return nil, nil, errBadProxyHeader
+	}
+	return &net.TCPAddr{IP: srcIP, Port: int(srcPort)},
+		&net.TCPAddr{IP: dstIP, Port: int(dstPort)}, nil
+}//-- end func readProxyV1
+
+func readProxyV2 (reader *bufio.Reader) (src, dst net.Addr, err error) {
+	header := make([]byte, 16)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return nil, nil, errBadProxyHeader
+	}
+	if header[12] >> 4 != 2 { return nil, nil, errBadProxyHeader }
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return nil, nil, errBadProxyHeader
+	}
+	if header[12] & 0x0F == 0 { return nil, nil, nil }//-- LOCAL command
+	var ipLen int
+	switch (header[13] >> 4) {
+		case 1:
+			ipLen = net.IPv4len
+		case 2:
+			ipLen = net.IPv6len
+		default:
+			return nil, nil, nil//-- AF_UNSPEC or AF_UNIX
+	}//-- end switch
+	if len(body) < 2 * ipLen + 4 { return nil, nil, errBadProxyHeader }
+	srcIP := net.IP(body[:ipLen])
+	dstIP := net.IP(body[ipLen:2 * ipLen])
+	ports := body[2 * ipLen:]
+	return &net.TCPAddr{IP: srcIP,
+			Port: int(binary.BigEndian.Uint16(ports[0:2]))},
+		&net.TCPAddr{IP: dstIP,
+			Port: int(binary.BigEndian.Uint16(ports[2:4]))}, nil
+}//-- end func readProxyV2
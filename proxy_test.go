@@ -0,0 +1,82 @@
+package webapp
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyHandler (t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil { t.Fatal(err) }
+	cases := []struct {
+		remote string
+		header http.Header
+		wantAddr, wantScheme, wantHost string
+	}{
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.5"},
+			"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"ex.com"}},
+			"203.0.113.5:0", "https", "ex.com"},
+		{"10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"198.51.100.9, 203.0.113.5, 10.1.1.1"}},
+			"203.0.113.5:0", "", "orig"},
+		{"192.0.2.1:80", http.Header{"Forwarded":
+			{`for="[2001:db8::1]:4711";proto=https;host=ex.com`}},
+			"[2001:db8::1]:4711", "https", "ex.com"},
+		{"198.51.100.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.5"}},
+			"198.51.100.1:1234", "", "orig"},
+		{"10.0.0.1:1234", http.Header{"Forwarded": {"for=unknown"}},
+			"10.0.0.1:1234", "", "orig"},
+	}//-- end cases
+	for i, c := range cases {
+		var got *http.Request
+		handler := makeProxyHandler(http.HandlerFunc(
+			func (_ http.ResponseWriter, r *http.Request) { got = r }), proxies)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "orig"
+		req.RemoteAddr, req.Header = c.remote, c.header
+		handler(httptest.NewRecorder(), req)
+		if got.RemoteAddr != c.wantAddr || got.URL.Scheme != c.wantScheme ||
+				got.Host != c.wantHost {
+			t.Errorf("case %d: got (%s, %s, %s), want (%s, %s, %s)", i,
+				got.RemoteAddr, got.URL.Scheme, got.Host, c.wantAddr,
+				c.wantScheme, c.wantHost)
+		}
+	}//-- end for range cases
+}//-- end TestProxyHandler
+
+func TestReadProxyHeader (t *testing.T) {
+	v2 := "\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c" +
+		"\xc0\x00\x02\x01\x0a\x00\x00\x01\x04\xd2\x00\x50"
+	cases := []struct {
+		input, wantSrc string
+		wantErr bool
+	}{
+		{"PROXY TCP4 192.0.2.1 10.0.0.1 1234 80\r\nGET", "192.0.2.1:1234",
+			false},
+		{"PROXY UNKNOWN\r\nGET", "", false},
+		{v2 + "GET", "192.0.2.1:1234", false},
+		{"GET / HTTP/1.1\r\n", "", true},
+		{"PROXY TCP4 nonsense\r\n", "", true},
+	}//-- end cases
+	for i, c := range cases {
+		reader := bufio.NewReader(strings.NewReader(c.input))
+		src, _, err := readProxyHeader(reader)
+		if (err != nil) != c.wantErr {
+			t.Errorf("case %d: unexpected error %v", i, err)
+			continue
+		}
+		gotSrc := ""
+		if src != nil { gotSrc = src.(*net.TCPAddr).String() }
+		if gotSrc != c.wantSrc {
+			t.Errorf("case %d: got source %q, want %q", i, gotSrc, c.wantSrc)
+		}
+		if !c.wantErr {
+			rest, _ := reader.ReadString('\n')
+			if rest != "GET" { t.Errorf("case %d: left %q unread", i, rest) }
+		}
+	}//-- end for range cases
+}//-- end TestReadProxyHeader
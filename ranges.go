@@ -0,0 +1,139 @@
+package webapp
+
+/**
+ * Byte-range requests (RFC 7233) for static content. Ranges are read
+ * straight from the cached content, single ranges answered with 206
+ * Partial Content and multiple ranges as multipart/byteranges.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// more ranges than this in one request are ignored as abusive
+const maxRanges = 64
+
+var errUnsatisfiableRange = errors.New("no requested range overlaps content")
+
+type byteRange struct {
+	start, length int64
+}//-- end byteRange struct
+
+func (br byteRange) contentRange (size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start + br.length - 1,
+		size)
+}//-- end func byteRange.contentRange
+
+// Parses a Range header against content of the given size. Returns nil
+// ranges (and no error) if the header should be ignored, and
+// errUnsatisfiableRange if no range overlaps the content.
+func parseRange (header string, size int64) ([]byteRange, error) {
+	if !strings.HasPrefix(header, "bytes=") { return nil, nil }
+	specs := strings.Split(strings.TrimPrefix(header, "bytes="), ",")
+	if len(specs) > maxRanges { return nil, nil }
+	ranges := make([]byteRange, 0, len(specs))
+	var total int64
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		dash := strings.Index(spec, "-")
+		if dash < 0 { return nil, nil }
+		first, last := spec[:dash], spec[dash + 1:]
+		var br byteRange
+		if first == "" {
+			//-- suffix range: the final n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 { return nil, nil }
+			if n == 0 { continue }
+			if n > size { n = size }
+			br = byteRange{size - n, n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 { return nil, nil }
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start { return nil, nil }
+				if end >= size { end = size - 1 }
+			}
+			if start >= size { continue }
+			br = byteRange{start, end - start + 1}
+		}
+		if br.length <= 0 { continue }
+		ranges = append(ranges, br)
+		total += br.length
+	}//-- end for range specs
+	if len(ranges) == 0 { return nil, errUnsatisfiableRange }
+	if total > size { return nil, nil }//-- cheaper to send it all
+	return ranges, nil
+}//-- end func parseRange
+
+// Reports whether an If-Range precondition, if any, still holds. Only
+// strong validators are honored, per RFC 7233, section 3.2.
+func ifRangeHolds (r *http.Request, etag string, modTime time.Time) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" { return true }
+	if strings.HasPrefix(ifRange, `"`) { return ifRange == etag }
+	date, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && date.Equal(modTime)
+}//-- end func ifRangeHolds
+
+// Writes content, or the ranges of it requested. Callers set any
+// validators and Cache-Control beforehand.
+func serveRanges (w http.ResponseWriter, r *http.Request,
+		content io.ReaderAt, size int64, contentType, etag string,
+		modTime time.Time) {
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	var ranges []byteRange
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && r.Method == http.MethodGet &&
+			ifRangeHolds(r, etag, modTime) {
+		var err error
+		ranges, err = parseRange(rangeHeader, size)
+		if err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
+	switch (len(ranges)) {
+		case 0:
+			header.Set("Content-Type", contentType)
+			header.Set("Content-Length", strconv.FormatInt(size, 10))
+			w.WriteHeader(http.StatusOK)
+			if r.Method != http.MethodHead {
+				io.Copy(w, io.NewSectionReader(content, 0, size))
+			}
+		case 1:
+			header.Set("Content-Type", contentType)
+			header.Set("Content-Range", ranges[0].contentRange(size))
+			header.Set("Content-Length",
+				strconv.FormatInt(ranges[0].length, 10))
+			w.WriteHeader(http.StatusPartialContent)
+			io.Copy(w, io.NewSectionReader(content, ranges[0].start,
+				ranges[0].length))
+		default:
+			parts := multipart.NewWriter(w)
+			header.Set("Content-Type",
+				"multipart/byteranges; boundary=" + parts.Boundary())
+			w.WriteHeader(http.StatusPartialContent)
+			for _, br := range ranges {
+				part, err := parts.CreatePart(textproto.MIMEHeader{
+					"Content-Type": {contentType},
+					"Content-Range": {br.contentRange(size)}})
+				if err != nil { return }
+				_, err = io.Copy(part, io.NewSectionReader(content, br.start,
+					br.length))
+				if err != nil { return }
+			}//-- end for range ranges
+			parts.Close()
+	}//-- end switch
+}//-- end func serveRanges
@@ -0,0 +1,259 @@
+package webapp
+
+/**
+ * Configuration hot reload. A ConfigWatcher reloads the config files
+ * when they change, or on SIGHUP, validates the result and hands it with
+ * the previous config to every subscriber. Fields tagged reload:"no"
+ * (such as Server.Port) only take effect on restart: a reload changing
+ * any of them is rejected whole, and the running config kept.
+ *
+ *	watcher, err := webapp.NewConfigWatcher(&webapp.ConfigLoader{
+ *		Filename: "config.yml"})
+ *	app, err := webapp.Init(watcher.Current(), ...)
+ *	watcher.Subscribe(app.Reconfigure)
+ *	watcher.Watch(5 * time.Second)
+ */
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Called with the previous and new configs after each successful reload
+type ConfigSubscriber func (old, cfg *Config)
+
+type ConfigWatcher struct {
+	loader *ConfigLoader
+	current *Config
+	stamps map[string]time.Time//-- modification times of loaded files
+	subscribers []ConfigSubscriber
+	stop chan struct{}
+	mut sync.Mutex
+	reloading sync.Mutex//-- serializes reloads, held while notifying
+}//-- end ConfigWatcher struct
+
+// Loads the initial config through loader.
+func NewConfigWatcher (loader *ConfigLoader) (*ConfigWatcher, error) {
+	cfg, err := loader.Load()
+	if err != nil { return nil, err }
+	return &ConfigWatcher{loader: loader, current: cfg,
+		stamps: fileStamps(loader.Files())}, nil
+}//-- end func NewConfigWatcher
+
+func fileStamps (filenames []string) map[string]time.Time {
+	stamps := make(map[string]time.Time, len(filenames))
+	for _, filename := range filenames {
+		if info, err := os.Stat(filename); err == nil {
+			stamps[filename] = info.ModTime()
+		}
+	}//-- end for range filenames
+	return stamps
+}//-- end func fileStamps
+
+// Returns the config in effect. It must not be modified.
+func (cw *ConfigWatcher) Current () *Config {
+	cw.mut.Lock()
+	defer cw.mut.Unlock()
+	return cw.current
+}//-- end func ConfigWatcher.Current
+
+func (cw *ConfigWatcher) Subscribe (sub ConfigSubscriber) {
+	cw.mut.Lock()
+	defer cw.mut.Unlock()
+	cw.subscribers = append(cw.subscribers, sub)
+}//-- end func ConfigWatcher.Subscribe
+
+// Reloads the config, keeping the current one if the new one is invalid
+// or changes fields that need a restart.
+func (cw *ConfigWatcher) Reload () error {
+	cw.reloading.Lock()
+	defer cw.reloading.Unlock()
+	cw.mut.Lock()
+	//-- validated below, once fields not reloaded are carried over
+	cfg, err := cw.loader.load(false)
+	cw.stamps = fileStamps(cw.loader.Files())
+	old := cw.current
+	cw.mut.Unlock()
+	if err != nil { return err }
+	copyUnloadable(reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem())
+	var errs ConfigErrors
+	reloadConflicts(reflect.ValueOf(old).Elem(), reflect.ValueOf(cfg).Elem(),
+		"", &errs)
+	cfg.eachSection(old, func (name string, val, oldVal reflect.Value) {
+		copyUnloadable(oldVal, val)
+		reloadConflicts(oldVal, val, name, &errs)
+	})
+	if err = errs.Err(); err != nil { return err }
+	if err = cfg.Validate(); err != nil { return err }
+	cw.mut.Lock()
+	cw.current = cfg
+	subscribers := append([]ConfigSubscriber(nil), cw.subscribers...)
+	cw.mut.Unlock()
+	for _, sub := range subscribers { sub(old, cfg) }
+	return nil
+}//-- end func ConfigWatcher.Reload
+
+// Checks the loaded files every interv (if positive), and listens for
+// SIGHUP, reloading as needed until Stop is called. Failed reloads are
+// logged.
+func (cw *ConfigWatcher) Watch (interv time.Duration) {
+	cw.mut.Lock()
+	if cw.stop != nil {
+		cw.mut.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	cw.stop = stop
+	cw.mut.Unlock()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if interv > 0 {
+		ticker = time.NewTicker(interv)
+		tick = ticker.C
+	}
+	go func () {
+		defer signal.Stop(hup)
+		if ticker != nil { defer ticker.Stop() }
+		for {
+			select {
+				case <-stop:
+					return
+				case <-hup:
+					cw.reloadLogged("SIGHUP")
+				case <-tick:
+					if cw.changed() { cw.reloadLogged("file change") }
+			}//-- end select
+		}//-- end for
+	}()
+}//-- end func ConfigWatcher.Watch
+
+func (cw *ConfigWatcher) Stop () {
+	cw.mut.Lock()
+	defer cw.mut.Unlock()
+	if cw.stop != nil {
+		close(cw.stop)
+		cw.stop = nil
+	}
+}//-- end func ConfigWatcher.Stop
+
+func (cw *ConfigWatcher) changed () bool {
+	cw.mut.Lock()
+	defer cw.mut.Unlock()
+	if cw.loader.Filename == stdinName { return false }
+	candidates := cw.loader.layers()
+	current := fileStamps(candidates)
+	for _, filename := range candidates {
+		if !current[filename].Equal(cw.stamps[filename]) { return true }
+	}
+	return false
+}//-- end func ConfigWatcher.changed
+
+func (cw *ConfigWatcher) reloadLogged (cause string) {
+	if err := cw.Reload(); err != nil {
+		logf(LogError, "config reload (%s) rejected: %s\n", cause, err.Error())
+		return
+	}
+	logf(LogInfo, "config reloaded (%s)\n", cause)
+}//-- end func ConfigWatcher.reloadLogged
+
+func noReload (field reflect.StructField) bool {
+	return field.Tag.Get("reload") == "no"
+}//-- end func noReload
+
+// Reports whether values of typ contain fields tagged reload:"no"
+func holdsNoReload (typ reflect.Type) bool {
+	switch (typ.Kind()) {
+		case reflect.Struct:
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if noReload(field) || holdsNoReload(field.Type) { return true }
+			}
+		case reflect.Slice, reflect.Array:
+			return holdsNoReload(typ.Elem())
+	}//-- end switch
+	return false
+}//-- end func holdsNoReload
+
+// Lists the fields tagged reload:"no" that differ between old and cfg
+func reloadConflicts (old, cfg reflect.Value, name string,
+		errs *ConfigErrors) {
+	switch (old.Kind()) {
+		case reflect.Struct:
+			typ := old.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if field.PkgPath != "" { continue }
+				fieldName := field.Name
+				if name != "" { fieldName = name + "." + field.Name }
+				if noReload(field) {
+					if !reflect.DeepEqual(old.Field(i).Interface(),
+							cfg.Field(i).Interface()) {
+						errs.Add(fmt.Errorf("%s cannot change without a restart",
+							fieldName))
+					}
+					continue
+				}
+				reloadConflicts(old.Field(i), cfg.Field(i), fieldName, errs)
+			}//-- end for range fields
+		case reflect.Slice, reflect.Array:
+			if !holdsNoReload(old.Type().Elem()) { return }
+			if old.Len() != cfg.Len() {
+				errs.Add(fmt.Errorf("%s entries cannot be added or removed " +
+					"without a restart", name))
+				return
+			}
+			for i := 0; i < old.Len(); i++ {
+				reloadConflicts(old.Index(i), cfg.Index(i),
+					fmt.Sprintf("%s[%d]", name, i), errs)
+			}
+	}//-- end switch
+}//-- end func reloadConflicts
+
+// Carries over fields that no config file can set (tagged json:"-", such
+// as Server.StaticFS) from old to cfg.
+func copyUnloadable (old, cfg reflect.Value) {
+	switch (old.Kind()) {
+		case reflect.Struct:
+			typ := old.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if field.PkgPath != "" { continue }
+				if field.Tag.Get("json") == "-" {
+					cfg.Field(i).Set(old.Field(i))
+					continue
+				}
+				copyUnloadable(old.Field(i), cfg.Field(i))
+			}//-- end for range fields
+		case reflect.Slice:
+			for i := 0; i < old.Len() && i < cfg.Len(); i++ {
+				copyUnloadable(old.Index(i), cfg.Index(i))
+			}
+	}//-- end switch
+}//-- end func copyUnloadable
+
+// Applies a reloaded config to the app: its log level, and the
+// reloadable server settings if the server supports them (see
+// DefaultServer.Reconfigure). Suitable for ConfigWatcher.Subscribe.
+func (app *Webapp) Reconfigure (old, cfg *Config) {
+	if cfg.LogLevel != old.LogLevel {
+		//-- validated already; an empty level restores the default
+		lvl, _ := ParseLogLevel(cfg.LogLevel)
+		SetLogLevel(lvl)
+	}
+	serverCfg := cfg.serverConfig()
+	svr, ok := app.server.(interface{ Reconfigure (*ServerConfig) error })
+	if !ok {
+		logf(LogWarn, "reconfigure: server settings need a restart\n")
+		return
+	}
+	if err := svr.Reconfigure(&serverCfg); err != nil {
+		logf(LogError, "reconfigure: %s\n", err.Error())
+	}
+}//-- end func Webapp.Reconfigure
@@ -0,0 +1,152 @@
+package webapp
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestConfigWatcherReload (t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func (port string, maxInFlight int) {
+		content := "loglevel: info\nserver:\n  port: \"" + port + "\"\n" +
+			"  staticdir: static\n  maxinflight: " +
+			strconv.Itoa(maxInFlight) + "\n" +
+			"database:\n  address: localhost\n  databasename: app\n"
+		err := ioutil.WriteFile(filename, []byte(content), 0644)
+		if err != nil { t.Fatal(err) }
+	}//-- end func write
+	write(":8080", 1)
+	watcher, err := NewConfigWatcher(&ConfigLoader{Filename: filename,
+		SkipEnv: true})
+	if err != nil { t.Fatal(err) }
+	watcher.Current().Server.StaticFS = fstest.MapFS{}
+	var notified []int
+	watcher.Subscribe(func (old, cfg *Config) {
+		notified = append(notified, old.Server.MaxInFlight,
+			cfg.Server.MaxInFlight)
+	})
+	write(":8080", 2)
+	if err = watcher.Reload(); err != nil { t.Fatal(err) }
+	if len(notified) != 2 || notified[0] != 1 || notified[1] != 2 {
+		t.Errorf("subscriber got %v", notified)
+	}
+	if watcher.Current().Server.StaticFS == nil {
+		t.Error("StaticFS not carried over")
+	}
+	write(":9090", 3)
+	err = watcher.Reload()
+	if err == nil || !strings.Contains(err.Error(), "Server.Port") {
+		t.Errorf("port change not rejected: %v", err)
+	}
+	if watcher.Current().Server.MaxInFlight != 2 || len(notified) != 2 {
+		t.Error("rejected reload was applied")
+	}
+}//-- end TestConfigWatcherReload
+
+func TestConfigWatcherWatch (t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yml")
+	write := func (waitSecs int, modTime time.Time) {
+		content := "waitsecs: " + strconv.Itoa(waitSecs) + "\n" +
+			"server:\n  port: \":8080\"\n  staticdir: static\n" +
+			"database:\n  address: localhost\n  databasename: app\n"
+		err := ioutil.WriteFile(filename, []byte(content), 0644)
+		if err == nil { err = os.Chtimes(filename, modTime, modTime) }
+		if err != nil { t.Fatal(err) }
+	}//-- end func write
+	start := time.Now().Add(-time.Hour)
+	write(1, start)
+	watcher, err := NewConfigWatcher(&ConfigLoader{Filename: filename,
+		SkipEnv: true})
+	if err != nil { t.Fatal(err) }
+	var waitSecs int32
+	watcher.Subscribe(func (_, cfg *Config) {
+		atomic.StoreInt32(&waitSecs, int32(cfg.WaitSecs))
+	})
+	watcher.Watch(10 * time.Millisecond)
+	defer watcher.Stop()
+	waitFor := func (cause string, want int32) {
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&waitSecs) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: no reload to waitsecs %d", cause, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}//-- end for
+	}//-- end func waitFor
+	write(2, start.Add(time.Minute))
+	waitFor("file change", 2)
+	//-- the same modification time hides the change from polling
+	write(3, start.Add(time.Minute))
+	proc, err := os.FindProcess(os.Getpid())
+	if err == nil { err = proc.Signal(syscall.SIGHUP) }
+	if err != nil { t.Skip("cannot send SIGHUP: " + err.Error()) }
+	waitFor("SIGHUP", 3)
+}//-- end TestConfigWatcherWatch
+
+func TestDefaultServerReconfigure (t *testing.T) {
+	cfg := &ServerConfig{Port: ":0", MaxInFlight: 1,
+		StaticFS: fstest.MapFS{"app.css": {Data: []byte("body {}")}},
+		CacheTimeoutSecs: 60,
+		AccessLog: AccessLogConfig{Format: "common", SampleRate: 0.5},
+		StaticMounts: []StaticMount{{Prefix: "/files", CacheTimeoutSecs: 60,
+			FS: fstest.MapFS{"docs/a.txt": {Data: []byte("a")}}}}}
+	svr := new(DefaultServer)
+	if err := svr.Init(cfg, &routeTable{Handler: http.NewServeMux()});
+			err != nil {
+		t.Fatal(err)
+	}
+	serve := func (path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		svr.ServeStatic(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}//-- end func serve
+	if rec := serve("/files/docs/"); rec.Code != http.StatusNotFound {
+		t.Errorf("listing before reconfigure: got %d", rec.Code)
+	}
+	reloaded := *cfg
+	reloaded.MaxInFlight, reloaded.MaxQueued = 4, 8
+	reloaded.QueueTimeoutSecs = 3
+	reloaded.CacheTimeoutSecs = 120
+	reloaded.AccessLog.SampleRate = 0.25
+	reloaded.StaticMounts = []StaticMount{cfg.StaticMounts[0]}
+	reloaded.StaticMounts[0].Listing = "json"
+	if err := svr.Reconfigure(&reloaded); err != nil { t.Fatal(err) }
+	if svr.limiter.maxInFlight != 4 || svr.limiter.maxQueued != 8 ||
+			svr.limiter.timeout != 3 * time.Second {
+		t.Errorf("limits not applied: %+v", svr.limiter)
+	}
+	rate := math.Float64frombits(
+		atomic.LoadUint64(&svr.accessLog.sampleRate))
+	if rate != 0.25 { t.Errorf("sample rate %g, want 0.25", rate) }
+	rec := serve("/app.css")
+	if cc := rec.Header().Get("Cache-Control"); cc != "max-age=120" {
+		t.Errorf("got Cache-Control %q", cc)
+	}
+	if rec := serve("/files/docs/"); rec.Code != http.StatusOK ||
+			!strings.Contains(rec.Body.String(), "a.txt") {
+		t.Errorf("listing after reconfigure: got %d %q", rec.Code,
+			rec.Body.String())
+	}
+	moved := reloaded
+	moved.StaticMounts = []StaticMount{{Prefix: "/other"}}
+	if err := svr.Reconfigure(&moved); err == nil {
+		t.Error("moved mount accepted")
+	}
+	moved.StaticMounts = nil
+	if err := svr.Reconfigure(&moved); err == nil ||
+			!strings.Contains(err.Error(), "added or removed") {
+		t.Errorf("removed mount accepted: %v", err)
+	}
+	if svr.limiter.maxInFlight != 4 { t.Error("rejected settings applied") }
+}//-- end TestDefaultServerReconfigure
@@ -1,6 +1,8 @@
 package resp
 
 import (
+	"bytes"
+	"context"
 	"net/http"
 	"strings"
 	"encoding/json"
@@ -108,15 +110,43 @@ func (txt *Text) Write (w http.ResponseWriter) {
 	w.Write([]byte(txt.Content))
 }//-- end func Text.Write
 
+// Stands in for the request's Content-Security-Policy nonce in HTML
+// content, e.g. <script nonce="%CSP_NONCE%">
+const NoncePlaceholder = "%CSP_NONCE%"
+
+type nonceKey struct{}
+
+// Returns a copy of r carrying the given CSP nonce
+func WithNonce (r *http.Request, nonce string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+}//-- end func WithNonce
+
+// Returns the CSP nonce of the request, or "" if it has none
+func Nonce (r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}//-- end func Nonce
+
+// Replaces every NoncePlaceholder in content with nonce
+func InjectNonce (content []byte, nonce string) []byte {
+	return bytes.Replace(content, []byte(NoncePlaceholder), []byte(nonce), -1)
+}//-- end func InjectNonce
+
 type HTML struct {
 	Code int
 	Content []byte
+	// if set, replaces NoncePlaceholder in Content; see Nonce
+	Nonce string
 }//-- end HTML struct
 
 func (doc *HTML) Write (w http.ResponseWriter) {
 	if doc.Code == 0 { doc.Code = http.StatusOK }
 	w.WriteHeader(doc.Code)
 	w.Header().Set("Content-Type", "text/html")
+	if doc.Nonce != "" {
+		w.Write(InjectNonce(doc.Content, doc.Nonce))
+		return
+	}
 	w.Write(doc.Content)
 }//-- end func HTML.Write
 
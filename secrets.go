@@ -0,0 +1,182 @@
+package webapp
+
+/**
+ * Secrets in configuration. Fields tagged `secret:"true"` (such as
+ * DatabaseConfig.Password) are redacted by Config.String and
+ * Config.Encode, and may be read from a file named by a sibling field
+ * with the suffix "File" (PasswordFile), as with Docker and Kubernetes
+ * secret mounts. Any string value may also refer to an environment
+ * variable or file with ${env:NAME} or ${file:/path}, resolved by
+ * ResolveSecrets once the config is loaded.
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// replaces the values of secret fields in printed configs
+const redacted = "[REDACTED]"
+
+var secretRef = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+func isSecret (field reflect.StructField) bool {
+	return field.Tag.Get("secret") == "true"
+}//-- end func isSecret
+
+// Reads a secret from a file, dropping the trailing newline that editors
+// and `echo` leave
+func readSecretFile (filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil { return "", err }
+	return strings.TrimRight(string(content), "\r\n"), nil
+}//-- end func readSecretFile
+
+// Returns a copy of the config, and its sections, with secret fields
+// redacted
+func (cfg *Config) Redacted () *Config {
+	copied := reflect.New(reflect.TypeOf(*cfg))
+	copied.Elem().Set(redactValue(reflect.ValueOf(*cfg)))
+	result := copied.Interface().(*Config)
+	result.sections = nil
+	cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+		if result.sections == nil {
+			result.sections = make(map[string]reflect.Value)
+		}
+		section := reflect.New(val.Type())
+		section.Elem().Set(redactValue(val))
+		result.sections[name] = section
+	})
+	return result
+}//-- end func Config.Redacted
+
+// Returns a copy of val with secret fields redacted, copying any slices
+// and maps holding them rather than altering the originals.
+func redactValue (val reflect.Value) reflect.Value {
+	switch (val.Kind()) {
+		case reflect.Struct:
+			copied := reflect.New(val.Type()).Elem()
+			copied.Set(val)
+			typ := val.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if field.PkgPath != "" { continue }
+				fieldVal := copied.Field(i)
+				if isSecret(field) && fieldVal.Kind() == reflect.String {
+					if fieldVal.Len() > 0 { fieldVal.SetString(redacted) }
+					continue
+				}
+				fieldVal.Set(redactValue(fieldVal))
+			}//-- end for range fields
+			return copied
+		case reflect.Slice:
+			if val.IsNil() || !holdsSecrets(val.Type().Elem()) { return val }
+			copied := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+			for i := 0; i < val.Len(); i++ {
+				copied.Index(i).Set(redactValue(val.Index(i)))
+			}
+			return copied
+		case reflect.Map:
+			if val.IsNil() || !holdsSecrets(val.Type().Elem()) { return val }
+			copied := reflect.MakeMapWithSize(val.Type(), val.Len())
+			for _, key := range val.MapKeys() {
+				copied.SetMapIndex(key, redactValue(val.MapIndex(key)))
+			}
+			return copied
+		default:
+			return val
+	}//-- end switch
+}//-- end func redactValue
+
+// Reports whether values of typ can contain secret fields
+func holdsSecrets (typ reflect.Type) bool {
+	switch (typ.Kind()) {
+		case reflect.Struct:
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if field.PkgPath != "" { continue }
+				if isSecret(field) || holdsSecrets(field.Type) { return true }
+			}
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return holdsSecrets(typ.Elem())
+	}//-- end switch
+	return false
+}//-- end func holdsSecrets
+
+// Resolves ${env:NAME} and ${file:/path} references in every string
+// value, and fills empty secret fields from their "File" siblings.
+// Problems are listed in the returned ConfigErrors.
+func (cfg *Config) ResolveSecrets () error {
+	var errs ConfigErrors
+	resolveSecrets(reflect.ValueOf(cfg).Elem(), "", &errs)
+	cfg.eachSection(nil, func (name string, val, _ reflect.Value) {
+		resolveSecrets(val, name, &errs)
+	})
+	return errs.Err()
+}//-- end func Config.ResolveSecrets
+
+func resolveSecrets (val reflect.Value, name string, errs *ConfigErrors) {
+	switch (val.Kind()) {
+		case reflect.String:
+			val.SetString(resolveRefs(val.String(), name, errs))
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < val.Len(); i++ {
+				resolveSecrets(val.Index(i), fmt.Sprintf("%s[%d]", name, i), errs)
+			}
+		case reflect.Struct:
+			typ := val.Type()
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if field.PkgPath != "" { continue }
+				fieldName := field.Name
+				if name != "" { fieldName = name + "." + field.Name }
+				resolveSecrets(val.Field(i), fieldName, errs)
+			}
+			for i := 0; i < typ.NumField(); i++ {
+				field := typ.Field(i)
+				if !isSecret(field) || val.Field(i).Kind() != reflect.String ||
+						val.Field(i).Len() > 0 {
+					continue
+				}
+				fileField := val.FieldByName(field.Name + "File")
+				if !fileField.IsValid() || fileField.Kind() != reflect.String ||
+						fileField.Len() == 0 {
+					continue
+				}
+				secret, err := readSecretFile(fileField.String())
+				if err != nil {
+					errs.Add(fmt.Errorf("%s.%sFile: %s", name, field.Name,
+						err.Error()))
+					continue
+				}
+				val.Field(i).SetString(secret)
+			}//-- end for range fields
+	}//-- end switch
+}//-- end func resolveSecrets
+
+// Substitutes the references in a single value
+func resolveRefs (value, name string, errs *ConfigErrors) string {
+	if !strings.Contains(value, "${") { return value }
+	return secretRef.ReplaceAllStringFunc(value, func (ref string) string {
+		match := secretRef.FindStringSubmatch(ref)
+		switch (match[1]) {
+			case "env":
+				resolved, exists := os.LookupEnv(match[2])
+				if !exists {
+					errs.Add(fmt.Errorf("%s: environment variable %s not set",
+						name, match[2]))
+				}
+				return resolved
+			default:
+				resolved, err := readSecretFile(match[2])
+				if err != nil {
+					errs.Add(fmt.Errorf("%s: %s", name, err.Error()))
+				}
+				return resolved
+		}//-- end switch
+	})
+}//-- end func resolveRefs
@@ -0,0 +1,50 @@
+package webapp
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigRedacted (t *testing.T) {
+	cfg := &Config{Database: DatabaseConfig{Username: "app",
+		Password: "hunter2"}}
+	out := cfg.String()
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, redacted) ||
+			!strings.Contains(out, `"username":"app"`) {
+		t.Errorf("String leaks or mangles: %s", out)
+	}
+	if cfg.Database.Password != "hunter2" {
+		t.Error("redaction altered the original")
+	}
+}//-- end TestConfigRedacted
+
+func TestResolveSecrets (t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db_password")
+	if err := ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_HOST", "db.internal")
+	cfg := &Config{Database: DatabaseConfig{Address: "${env:TEST_DB_HOST}:3306",
+		PasswordFile: secretFile},
+		Server: ServerConfig{CertFile: "${file:" + secretFile + "}"}}
+	if err := cfg.ResolveSecrets(); err != nil { t.Fatal(err) }
+	if cfg.Database.Address != "db.internal:3306" ||
+			cfg.Database.Password != "s3cret" || cfg.Server.CertFile != "s3cret" {
+		t.Errorf("unexpected resolution: %+v", cfg)
+	}
+	cfg = &Config{Index: "${env:TEST_UNSET_VAR}",
+		Database: DatabaseConfig{PasswordFile: filepath.Join(dir, "missing")}}
+	err := cfg.ResolveSecrets()
+	if errs, ok := err.(ConfigErrors); !ok || len(errs) != 2 {
+		t.Errorf("got error %v, want two ConfigErrors", err)
+	}
+	t.Setenv("TEST_DATABASE_PASSWORD_FILE", secretFile)
+	cfg = &Config{}
+	if err = cfg.ApplyEnv("TEST"); err != nil { t.Fatal(err) }
+	if cfg.Database.Password != "s3cret" {
+		t.Errorf("_FILE variable not read: %q", cfg.Database.Password)
+	}
+}//-- end TestResolveSecrets
@@ -0,0 +1,183 @@
+package webapp
+
+/**
+ * Application-defined config sections. An app registers a struct for
+ * each of its own settings, keyed by name, before loading its config:
+ *
+ *	type SMTPConfig struct {
+ *		Host string `json:"host" xml:"host" yaml:"host" toml:"host"`
+ *		Password string `json:"password" ... secret:"true"`
+ *	}
+ *	webapp.RegisterSection("smtp", &SMTPConfig{Host: "localhost"})
+ *	...
+ *	smtp := cfg.Section("smtp").(*SMTPConfig)
+ *
+ * The section is then decoded from the "smtp" key of the same files as
+ * the rest of the config, starting from the registered defaults. It gets
+ * the same treatment as the built-in sections: environment overrides
+ * (WEBAPP_SMTP_HOST), secrets, strict decoding and, if it has a
+ * Validate () error method, validation. A field's `help` tag describes
+ * it in flag usage and sample configs.
+ */
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type sectionDef struct {
+	name string
+	defaults reflect.Value//-- the struct registered
+}//-- end sectionDef struct
+
+var (
+	sectionDefs []sectionDef
+	sectionMut sync.RWMutex
+	sectionName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+)
+
+// Registers a config section, given a pointer to a struct holding its
+// defaults; name must be lowercase, and not a key of Config. Panics if
+// name is invalid or taken, or defaults is not a struct pointer.
+func RegisterSection (name string, defaults interface{}) {
+	val := reflect.ValueOf(defaults)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("webapp: RegisterSection needs a pointer to a struct")
+	}
+	sectionMut.Lock()
+	defer sectionMut.Unlock()
+	if !sectionName.MatchString(name) || builtinKey(name) {
+		panic(fmt.Sprintf(`webapp: invalid section name "%s"`, name))
+	}
+	for _, def := range sectionDefs {
+		if def.name == name {
+			panic(fmt.Sprintf(`webapp: section "%s" registered twice`, name))
+		}
+	}//-- end for range sectionDefs
+	copied := reflect.New(val.Elem().Type()).Elem()
+	copied.Set(val.Elem())
+	sectionDefs = append(sectionDefs, sectionDef{name: name,
+		defaults: copied})
+}//-- end func RegisterSection
+
+// Reports whether name is a key of Config itself
+func builtinKey (name string) bool {
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		key := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if key == name { return true }
+	}
+	return false
+}//-- end func builtinKey
+
+func registeredSections () []sectionDef {
+	sectionMut.RLock()
+	defer sectionMut.RUnlock()
+	return append([]sectionDef(nil), sectionDefs...)
+}//-- end func registeredSections
+
+// Returns the named section, as a pointer to the struct registered for
+// it; nil if no such section is registered.
+func (cfg *Config) Section (name string) interface{} {
+	cfg.initSections()
+	if section, exists := cfg.sections[name]; exists {
+		return section.Interface()
+	}
+	return nil
+}//-- end func Config.Section
+
+// Fills in defaults for any sections registered since cfg was created
+func (cfg *Config) initSections () {
+	for _, def := range registeredSections() {
+		if _, exists := cfg.sections[def.name]; exists { continue }
+		if cfg.sections == nil {
+			cfg.sections = make(map[string]reflect.Value)
+		}
+		section := reflect.New(def.defaults.Type())
+		section.Elem().Set(def.defaults)
+		cfg.sections[def.name] = section
+	}//-- end for range defs
+}//-- end func Config.initSections
+
+// Names of cfg's sections, in order of registration
+func (cfg *Config) sectionNames () []string {
+	cfg.initSections()
+	var names []string
+	for _, def := range registeredSections() {
+		if _, exists := cfg.sections[def.name]; exists {
+			names = append(names, def.name)
+		}
+	}
+	return names
+}//-- end func Config.sectionNames
+
+// Returns a pointer to a struct embedding a copy of cfg, with a field
+// for each section holding a copy of cfg's own, keyed by name; decoding
+// into it decodes the whole file at once. See fromDocument.
+func (cfg *Config) document () reflect.Value {
+	names := cfg.sectionNames()
+	fields := []reflect.StructField{{Name: "Config",
+		Type: reflect.TypeOf(Config{}), Anonymous: true,
+		Tag: `yaml:",inline" hcl:",squash"`}}
+	for i, name := range names {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Section%d", i),
+			Type: cfg.sections[name].Type().Elem(),
+			Tag: reflect.StructTag(fmt.Sprintf(
+				`json:"%s" xml:"%s" yaml:"%s" toml:"%s" hcl:"%s"`,
+				name, name, name, name, name))})
+	}//-- end for range names
+	doc := reflect.New(reflect.StructOf(fields))
+	doc.Elem().Field(0).Set(reflect.ValueOf(*cfg))
+	for i, name := range names {
+		doc.Elem().Field(i + 1).Set(cfg.sections[name].Elem())
+	}
+	return doc
+}//-- end func Config.document
+
+// Copies the decoded settings back from a document
+func (cfg *Config) fromDocument (doc reflect.Value) {
+	names := cfg.sectionNames()
+	*cfg = doc.Elem().Field(0).Interface().(Config)
+	for i, name := range names {
+		cfg.sections[name].Elem().Set(doc.Elem().Field(i + 1))
+	}
+}//-- end func Config.fromDocument
+
+// Decodes into cfg, along with its sections
+func (cfg *Config) decodeFrom (dec decoder) error {
+	if len(cfg.sectionNames()) == 0 { return dec.Decode(cfg) }
+	doc := cfg.document()
+	err := dec.Decode(doc.Interface())
+	cfg.fromDocument(doc)
+	return err
+}//-- end func Config.decodeFrom
+
+// Returns what to encode for cfg: cfg itself, or a document holding its
+// sections too
+func (cfg *Config) encodable () interface{} {
+	if len(cfg.sectionNames()) == 0 { return cfg }
+	return cfg.document().Interface()
+}//-- end func Config.encodable
+
+// Applies fn to the struct of each section of cfg, and of other if given
+func (cfg *Config) eachSection (other *Config,
+		fn func (name string, val, otherVal reflect.Value)) {
+	for _, name := range cfg.sectionNames() {
+		var otherVal reflect.Value
+		if other != nil {
+			other.initSections()
+			otherVal = other.sections[name].Elem()
+		}
+		fn(name, cfg.sections[name].Elem(), otherVal)
+	}//-- end for range names
+}//-- end func Config.eachSection
+
+// Returns the name of the section in environment variables: smtp ->
+// SMTP, feature-flags -> FEATURE_FLAGS
+func sectionEnvName (name string) string {
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}//-- end func sectionEnvName
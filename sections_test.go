@@ -0,0 +1,71 @@
+package webapp
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testSMTPConfig struct {
+	Host string `json:"host" xml:"host" yaml:"host" toml:"host"`
+	Port int `json:"port" xml:"port" yaml:"port" toml:"port"`
+	Password string `json:"password" xml:"password" yaml:"password" toml:"password" secret:"true"`
+}//-- end testSMTPConfig struct
+
+func (cfg *testSMTPConfig) Validate () error {
+	if cfg.Port <= 0 { return errors.New("Invalid Port") }
+	return nil
+}//-- end func testSMTPConfig.Validate
+
+func init () {
+	RegisterSection("smtp", &testSMTPConfig{Host: "localhost", Port: 25})
+}//-- end func init
+
+func TestConfigSections (t *testing.T) {
+	setRequiredEnv(t)
+	sources := map[string]string{
+		"json": `{"index": "index.html", "smtp": {"port": 587,
+			"password": "hunter2"}}`,
+		"xml": "<Config><index>index.html</index><smtp><port>587</port>" +
+			"<password>hunter2</password></smtp></Config>",
+		"yaml": "index: index.html\nsmtp:\n  port: 587\n  password: hunter2\n",
+		"toml": "index = \"index.html\"\n\n[smtp]\nport = 587\n" +
+			"password = \"hunter2\"\n",
+		"hcl": "index = \"index.html\"\nsmtp {\n  port = 587\n" +
+			"  password = \"hunter2\"\n}\n"}
+	for format, source := range sources {
+		cfg, err := LoadConfigReader(strings.NewReader(source), format)
+		if err != nil {
+			t.Errorf("%s: %s", format, err.Error())
+			continue
+		}
+		smtp := cfg.Section("smtp").(*testSMTPConfig)
+		if cfg.Index != "index.html" || smtp.Host != "localhost" ||
+				smtp.Port != 587 || smtp.Password != "hunter2" {
+			t.Errorf("%s: got %+v, section %+v", format, cfg, smtp)
+		}
+	}//-- end for range sources
+	_, err := LoadConfigReader(strings.NewReader("smtp:\n  prot: 1\n"), "yaml")
+	if err == nil { t.Error("unknown section key accepted") }
+
+	os.Setenv("WEBAPP_SMTP_PORT", "0")
+	_, err = LoadConfigReader(strings.NewReader(sources["yaml"]), "yaml")
+	os.Unsetenv("WEBAPP_SMTP_PORT")
+	if err == nil || !strings.Contains(err.Error(), "smtp: Invalid Port") {
+		t.Errorf("got validation error %v", err)
+	}
+	cfg, err := LoadConfigReader(strings.NewReader(sources["yaml"]), "yaml")
+	if err != nil { t.Fatal(err) }
+	var buf bytes.Buffer
+	if err = cfg.Encode(&buf, "yaml"); err != nil { t.Fatal(err) }
+	if !strings.Contains(buf.String(), "host: localhost") ||
+			strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("unexpected encoding:\n%s", buf.String())
+	}
+	if cfg.Section("smtp").(*testSMTPConfig).Password != "hunter2" {
+		t.Error("encoding redacted the config itself")
+	}
+	if cfg.Section("none") != nil { t.Error("got unregistered section") }
+}//-- end TestConfigSections
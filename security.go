@@ -0,0 +1,92 @@
+package webapp
+
+/**
+ * Security response headers, applied by DefaultServer to every response,
+ * both registered routes and static files. When enabled, each carries
+ * X-Content-Type-Options, Referrer-Policy and, if configured,
+ * Permissions-Policy and Content-Security-Policy. HSTS is configured
+ * apart from these (see ServerConfig.HSTSMaxAgeSecs), as it cannot be
+ * undone once browsers have seen it. Each request is assigned a random
+ * nonce, substituted for "{nonce}" in the CSP and available to handlers
+ * through CSPNonce, to resp.HTML through its Nonce field, to templates
+ * through the cspNonce function (see Webapp.TemplateFuncs), and to static
+ * HTML files in place of resp.NoncePlaceholder.
+ */
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	// local imports
+	"gopkg.in/ollykel/webapp.v0/resp"
+)
+
+// replaced by the request's nonce in SecurityHeadersConfig.CSP
+const cspNonceToken = "{nonce}"
+
+// Settings are described in help.go
+type SecurityHeadersConfig struct {
+	Enabled bool `json:"enabled" xml:"enabled" toml:"enabled"`
+	// e.g. "default-src 'self'; script-src 'self' 'nonce-{nonce}'"
+	CSP string `json:"csp" xml:"csp" toml:"csp"`
+	CSPReportOnly bool `json:"cspreportonly" xml:"cspreportonly" toml:"cspreportonly"`
+	ReferrerPolicy string `json:"referrerpolicy" xml:"referrerpolicy" toml:"referrerpolicy" default:"strict-origin-when-cross-origin"`
+	// e.g. "camera=(), geolocation=()"
+	PermissionsPolicy string `json:"permissionspolicy" xml:"permissionspolicy" toml:"permissionspolicy"`
+}//-- end SecurityHeadersConfig struct
+
+var referrerPolicies = []string{"no-referrer", "no-referrer-when-downgrade",
+	"origin", "origin-when-cross-origin", "same-origin", "strict-origin",
+	"strict-origin-when-cross-origin", "unsafe-url"}
+
+func (cfg *SecurityHeadersConfig) Validate () error {
+	if strings.ContainsAny(cfg.CSP + cfg.PermissionsPolicy, "\r\n") {
+		return fmt.Errorf("Security header contains a line break")
+	}
+	if cfg.ReferrerPolicy == "" { return nil }
+	for _, policy := range strings.Split(cfg.ReferrerPolicy, ",") {
+		valid := false
+		for _, known := range referrerPolicies {
+			if strings.TrimSpace(policy) == known { valid = true }
+		}
+		if !valid {
+			return fmt.Errorf(`Invalid ReferrerPolicy "%s"`, cfg.ReferrerPolicy)
+		}
+	}//-- end for range policies
+	return nil
+}//-- end func SecurityHeadersConfig.Validate
+
+// Returns the Content-Security-Policy nonce of the request, or "" if
+// security headers are disabled. Use it as the nonce attribute of inline
+// scripts and styles.
+func CSPNonce (r *http.Request) string {
+	return resp.Nonce(r)
+}//-- end func CSPNonce
+
+func newCSPNonce () string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.StdEncoding.EncodeToString(buf)
+}//-- end func newCSPNonce
+
+func makeSecurityHandler (next http.Handler,
+		cfg *SecurityHeadersConfig) http.HandlerFunc {
+	referrer := cfg.ReferrerPolicy
+	if referrer == "" { referrer = "strict-origin-when-cross-origin" }
+	cspHeader := "Content-Security-Policy"
+	if cfg.CSPReportOnly { cspHeader += "-Report-Only" }
+	csp, permissions := cfg.CSP, cfg.PermissionsPolicy
+	return func (w http.ResponseWriter, r *http.Request) {
+		nonce := newCSPNonce()
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", referrer)
+		if permissions != "" { header.Set("Permissions-Policy", permissions) }
+		if csp != "" {
+			header.Set(cspHeader, strings.Replace(csp, cspNonceToken, nonce, -1))
+		}
+		next.ServeHTTP(w, resp.WithNonce(r, nonce))
+	}//-- end return
+}//-- end func makeSecurityHandler
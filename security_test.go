@@ -0,0 +1,91 @@
+package webapp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	// local imports
+	"gopkg.in/ollykel/webapp.v0/resp"
+)
+
+func TestSecurityHeaders (t *testing.T) {
+	cfg := &SecurityHeadersConfig{Enabled: true,
+		CSP: "script-src 'self' 'nonce-{nonce}'"}
+	if err := cfg.Validate(); err != nil { t.Fatal(err) }
+	page := []byte(`<script nonce="` + resp.NoncePlaceholder + `"></script>`)
+	handler := makeSecurityHandler(http.HandlerFunc(
+		func (w http.ResponseWriter, r *http.Request) {
+			doc := resp.HTML{Content: page, Nonce: CSPNonce(r)}
+			doc.Write(w)
+		}), cfg)
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/", nil))
+		header := rec.Header()
+		if header.Get("X-Content-Type-Options") != "nosniff" ||
+				header.Get("Referrer-Policy") != "strict-origin-when-cross-origin" {
+			t.Errorf("missing headers: %v", header)
+		}
+		csp := header.Get("Content-Security-Policy")
+		nonce := strings.TrimSuffix(strings.TrimPrefix(csp,
+			"script-src 'self' 'nonce-"), "'")
+		if nonce == "" || nonce == csp || seen[nonce] {
+			t.Fatalf("bad nonce in CSP %q", csp)
+		}
+		seen[nonce] = true
+		if want := `<script nonce="` + nonce + `"></script>`;
+				rec.Body.String() != want {
+			t.Errorf("got body %q, want %q", rec.Body.String(), want)
+		}
+	}//-- end for
+	cfg.ReferrerPolicy = "sometimes"
+	if cfg.Validate() == nil { t.Error("invalid ReferrerPolicy accepted") }
+}//-- end TestSecurityHeaders
+
+// Stands in for a database, for tests of Init
+type stubDatabase struct {
+	Database
+}//-- end stubDatabase struct
+
+func (db *stubDatabase) Init (*DatabaseConfig) error { return nil }
+
+func TestSecurityInit (t *testing.T) {
+	page := `<html><script nonce="` + resp.NoncePlaceholder +
+		`"></script></html>`
+	config := &Config{Index: "index.html", Server: ServerConfig{Port: ":0",
+		TLSEnabled: true, CertFile: "cert.pem", KeyFile: "key.pem",
+		StaticFS: fstest.MapFS{"index.html": {Data: []byte(page)}},
+		SecurityHeaders: SecurityHeadersConfig{Enabled: true,
+			CSP: "script-src 'nonce-{nonce}'"}}}
+	svr := new(DefaultServer)
+	app, err := Init(config, svr, http.NewServeMux(), new(stubDatabase))
+	if err != nil { t.Fatal(err) }
+	if config.Server.Index != "" { t.Error("Init modified the config") }
+	app.HandleFunc("/page", func (w http.ResponseWriter, r *http.Request) {
+		doc := resp.HTML{Content: []byte(page), Nonce: CSPNonce(r)}
+		doc.Write(w)
+	})
+	for _, path := range []string{"/", "/index.html", "/page"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.TLS = new(tls.ConnectionState)
+		rec := httptest.NewRecorder()
+		svr.Handler.ServeHTTP(rec, req)
+		nonce := strings.TrimSuffix(strings.TrimPrefix(
+			rec.Header().Get("Content-Security-Policy"), "script-src 'nonce-"),
+			"'")
+		if want := `<html><script nonce="` + nonce + `"></script></html>`;
+				nonce == "" || rec.Body.String() != want {
+			t.Errorf("%s: got body %q, want %q", path, rec.Body.String(), want)
+		}
+		if path != "/page" && rec.Header().Get("ETag") != "" {
+			t.Errorf("%s: ETag sent with a per-request nonce", path)
+		}
+		if hsts := rec.Header().Get("Strict-Transport-Security"); hsts != "" {
+			t.Errorf("%s: HSTS %q sent without HSTSMaxAgeSecs", path, hsts)
+		}
+	}//-- end for range paths
+}//-- end TestSecurityInit
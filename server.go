@@ -9,35 +9,94 @@ package webapp
 import (
 	"log"
 	"fmt"
-	"os"
-	"io/ioutil"
+	"net"
 	"net/http"
+	"io/fs"
 	"context"
 	"errors"
-	"sync"
+	"strings"
 	"time"
 )
 
+// Settings are described in help.go
 type ServerConfig struct {
-	Port string
-	StaticDir string
-	TLSEnabled bool
-	CertFile, KeyFile string
-	CacheTimeoutSecs int
-	StaticCacheRefreshSecs int
+	Port string `json:"port" xml:"port" toml:"port" reload:"no" default:":8080"`
+	StaticDir string `json:"staticdir" xml:"staticdir" toml:"staticdir" reload:"no"`
+	// if set, static files are served from here instead of StaticDir,
+	// e.g. an embed.FS (see fs.Sub to serve a subdirectory of one)
+	StaticFS fs.FS `json:"-" xml:"-" yaml:"-" toml:"-" reload:"no"`
+	Index string `json:"index" xml:"index" toml:"index"`
+	SPAFallback bool `json:"spafallback" xml:"spafallback" toml:"spafallback"`
+	SPAExcludePrefixes []string `json:"spaexcludeprefixes" xml:"spaexcludeprefixes" toml:"spaexcludeprefixes"`
+	TLSEnabled bool `json:"tlsenabled" xml:"tlsenabled" toml:"tlsenabled" reload:"no"`
+	CertFile string `json:"certfile" xml:"certfile" toml:"certfile" reload:"no"`
+	KeyFile string `json:"keyfile" xml:"keyfile" toml:"keyfile" reload:"no"`
+	CacheTimeoutSecs int `json:"cachetimeoutsecs" xml:"cachetimeoutsecs" toml:"cachetimeoutsecs"`
+	// paths matching no rule get "max-age=CacheTimeoutSecs"
+	CacheRules []CacheRule `json:"cacherules" xml:"cacherules" toml:"cacherules"`
+	// see static.go
+	StaticCacheRefreshSecs int `json:"staticcacherefreshsecs" xml:"staticcacherefreshsecs" toml:"staticcacherefreshsecs" reload:"no"`
+	StaticPollOnly bool `json:"staticpollonly" xml:"staticpollonly" toml:"staticpollonly" reload:"no"`
+	// see cache.go
+	StaticStreamThreshold int64 `json:"staticstreamthreshold" xml:"staticstreamthreshold" toml:"staticstreamthreshold" reload:"no"`
+	StaticCacheMaxBytes int64 `json:"staticcachemaxbytes" xml:"staticcachemaxbytes" toml:"staticcachemaxbytes" reload:"no"`
+	// see fingerprint.go
+	Fingerprint bool `json:"fingerprint" xml:"fingerprint" toml:"fingerprint" reload:"no"`
+	StaticListing string `json:"staticlisting" xml:"staticlisting" toml:"staticlisting"`
+	// see mounts.go
+	StaticMounts []StaticMount `json:"staticmounts" xml:"staticmounts" toml:"staticmounts"`
+	RedirectPort string `json:"redirectport" xml:"redirectport" toml:"redirectport" reload:"no"`
+	HSTSMaxAgeSecs int `json:"hstsmaxagesecs" xml:"hstsmaxagesecs" toml:"hstsmaxagesecs" reload:"no"`
+	HSTSIncludeSubdomains bool `json:"hstsincludesubdomains" xml:"hstsincludesubdomains" toml:"hstsincludesubdomains" reload:"no"`
+	// see proxy.go
+	TrustedProxies []string `json:"trustedproxies" xml:"trustedproxies" toml:"trustedproxies" reload:"no"`
+	ProxyProtocol bool `json:"proxyprotocol" xml:"proxyprotocol" toml:"proxyprotocol" reload:"no"`
+	// see admin.go
+	AdminPort string `json:"adminport" xml:"adminport" toml:"adminport" reload:"no"`
+	// see limit.go
+	MaxConns int `json:"maxconns" xml:"maxconns" toml:"maxconns" reload:"no"`
+	MaxInFlight int `json:"maxinflight" xml:"maxinflight" toml:"maxinflight"`
+	MaxQueued int `json:"maxqueued" xml:"maxqueued" toml:"maxqueued"`
+	QueueTimeoutSecs int `json:"queuetimeoutsecs" xml:"queuetimeoutsecs" toml:"queuetimeoutsecs"`
+	// see accesslog.go
+	AccessLog AccessLogConfig `json:"accesslog" xml:"accesslog" toml:"accesslog"`
+	// see security.go
+	SecurityHeaders SecurityHeadersConfig `json:"securityheaders" xml:"securityheaders" toml:"securityheaders" reload:"no"`
 }//-- end ServerConfig struct
 
+// Returns every problem found, as ConfigErrors
 func (cfg *ServerConfig) Validate () error {
+	var errs ConfigErrors
 	if cfg.Port == "" {
-		return errors.New("No Port provided to ServerConfig")
+		errs.Add(errors.New("No Port provided to ServerConfig"))
 	}
 	if cfg.TLSEnabled && (cfg.CertFile == "" || cfg.KeyFile == "") {
-		return errors.New("TLSEnabled, but CertFile or KeyFile not given")
+		errs.Add(errors.New("TLSEnabled, but CertFile or KeyFile not given"))
 	}
-	if cfg.StaticDir == "" {
-		return errors.New("No StaticDir provided to ServerConfig")
+	errs.Add(cfg.validateMounts())
+	if cfg.RedirectPort != "" && !cfg.TLSEnabled {
+		errs.Add(errors.New("RedirectPort given, but TLSEnabled not set"))
 	}
-	return nil
+	if cfg.RedirectPort != "" && cfg.RedirectPort == cfg.Port {
+		errs.Add(errors.New("RedirectPort must differ from Port"))
+	}
+	if cfg.StaticStreamThreshold < 0 || cfg.StaticCacheMaxBytes < 0 {
+		errs.Add(errors.New("Negative static cache size in ServerConfig"))
+	}
+	if cfg.MaxConns < 0 || cfg.MaxInFlight < 0 || cfg.MaxQueued < 0 ||
+			cfg.QueueTimeoutSecs < 0 {
+		errs.Add(errors.New("Negative load limit in ServerConfig"))
+	}
+	if cfg.AdminPort != "" && (cfg.AdminPort == cfg.Port ||
+			cfg.AdminPort == cfg.RedirectPort) {
+		errs.Add(errors.New("AdminPort must differ from Port and RedirectPort"))
+	}
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		errs.Add(err)
+	}
+	errs.Add(cfg.SecurityHeaders.Validate())
+	errs.Add(cfg.AccessLog.Validate())
+	return errs.Err()
 }//-- end DefaultServer.Validate
 
 type Server interface {
@@ -53,8 +112,17 @@ type Server interface {
 type DefaultServer struct {
 	http.Server
 	staticServer cachedStaticServer
+	staticMounts []*staticMount
 	tlsEnabled bool
 	certFile, keyFile string
+	redirectServer *http.Server//-- nil unless RedirectPort given
+	proxies trustedProxies
+	proxyProtocol bool
+	adminServer *http.Server//-- nil unless AdminPort given
+	routes func() []string//-- nil if Handler cannot list its routes
+	conns *connLimit
+	limiter *requestLimiter
+	accessLog *accessLogger//-- nil unless AccessLog.Format given
 }//-- end DefaultServer struct
 
 func (svr *DefaultServer) Init (cfg *ServerConfig, handler Handler) error {
@@ -64,119 +132,219 @@ func (svr *DefaultServer) Init (cfg *ServerConfig, handler Handler) error {
 	if err != nil { return err }
 	svr.Addr = cfg.Port
 	svr.Handler = handler
-	svr.staticServer = makeStaticServer(cfg)
+	svr.staticServer, svr.staticMounts = makeStaticServer(cfg)
+	svr.limiter = new(requestLimiter)
+	svr.limiter.SetLimits(cfg.MaxInFlight, cfg.MaxQueued,
+		time.Duration(cfg.QueueTimeoutSecs) * time.Second)
+	svr.Handler = makeLimitHandler(svr.Handler, svr.limiter)
+	svr.conns = newConnLimit(cfg.MaxConns)
+	if cfg.SecurityHeaders.Enabled {
+		svr.Handler = makeSecurityHandler(svr.Handler, &cfg.SecurityHeaders)
+	}
 	svr.tlsEnabled = cfg.TLSEnabled
 	if cfg.TLSEnabled {
 		svr.certFile, svr.keyFile = cfg.CertFile, cfg.KeyFile
+		if cfg.HSTSMaxAgeSecs > 0 {
+			svr.Handler = makeHSTSHandler(svr.Handler, cfg.HSTSMaxAgeSecs,
+				cfg.HSTSIncludeSubdomains)
+		}
+		if cfg.RedirectPort != "" {
+			svr.redirectServer = &http.Server{Addr: cfg.RedirectPort,
+				Handler: makeRedirectHandler(cfg.Port)}
+		}
+	}
+	if cfg.AccessLog.Format != "" {
+		svr.accessLog, err = newAccessLogger(&cfg.AccessLog)
+		if err != nil { return err }
+		svr.Handler = makeAccessLogHandler(svr.Handler, svr.accessLog)
+	}
+	svr.proxies, _ = parseTrustedProxies(cfg.TrustedProxies)
+	if len(svr.proxies) > 0 {
+		svr.Handler = makeProxyHandler(svr.Handler, svr.proxies)
+	}
+	svr.proxyProtocol = cfg.ProxyProtocol
+	if lister, ok := handler.(interface{ Routes () []string }); ok {
+		svr.routes = lister.Routes
+	}
+	publishVar("server", func() interface{} { return svr.Stats() })
+	publishVar("static", func() interface{} { return svr.StaticStats() })
+	if cfg.AdminPort != "" {
+		svr.adminServer = &http.Server{Addr: cfg.AdminPort,
+			Handler: svr.makeAdminHandler()}
 	}
 	return nil
 }//-- end func DefaultServer.Init
 
+// Applies the reloadable settings of cfg (those not tagged reload:"no")
+// to the running server: request limits, access log sampling, and the
+// caching, index, listing and SPA settings of static mounts.
+func (svr *DefaultServer) Reconfigure (cfg *ServerConfig) error {
+	if err := cfg.Validate(); err != nil { return err }
+	mounts := cfg.staticMounts()
+	if len(mounts) != len(svr.staticMounts) {
+		return errors.New("Static mounts cannot be added or removed " +
+			"without a restart")
+	}
+	for i, mount := range svr.staticMounts {
+		if mountPrefix(mounts[i].Prefix) != mount.Prefix {
+			return fmt.Errorf(`Static mount "%s" cannot be moved without a ` +
+				"restart", mount.Prefix)
+		}
+	}
+	for i, mount := range svr.staticMounts { mount.reconfigure(mounts[i]) }
+	svr.limiter.SetLimits(cfg.MaxInFlight, cfg.MaxQueued,
+		time.Duration(cfg.QueueTimeoutSecs) * time.Second)
+	if svr.accessLog != nil {
+		svr.accessLog.setSampleRate(cfg.AccessLog.SampleRate)
+	}
+	return nil
+}//-- end func DefaultServer.Reconfigure
+
+func makeHSTSHandler (next http.Handler, maxAge int,
+		subdomains bool) http.HandlerFunc {
+	header := fmt.Sprintf("max-age=%d", maxAge)
+	if subdomains { header += "; includeSubDomains" }
+	return func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", header)
+		next.ServeHTTP(w, r)
+	}//-- end return
+}//-- end func makeHSTSHandler
+
+// Permanently redirects every request to the same host and URI over
+// https, at the port given by tlsAddr.
+func makeRedirectHandler (tlsAddr string) http.HandlerFunc {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddr)
+	return func (w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"//-- bare IPv6 address
+		}
+		http.Redirect(w, r, "https://" + host + r.URL.RequestURI(),
+			http.StatusPermanentRedirect)
+	}//-- end return
+}//-- end func makeRedirectHandler
+
 func (svr *DefaultServer) GetAddr () string {
 	return svr.Addr
 }//-- end func DefaultServer.GetAddr
 
+func (svr *DefaultServer) listen () (net.Listener, error) {
+	ln, err := net.Listen("tcp", svr.Addr)
+	if err != nil { return nil, err }
+	ln = newLimitListener(ln, svr.conns)
+	if svr.proxyProtocol {
+		ln = &proxyListener{Listener: ln, trusted: svr.proxies}
+	}
+	return ln, nil
+}//-- end func DefaultServer.listen
+
 func (svr *DefaultServer) Serve () error {
+	ln, err := svr.listen()
+	if err != nil { return err }
+	failed := make(chan error, 2)
+	if svr.adminServer != nil {
+		err = svr.serveAux("admin", svr.adminServer, failed)
+	}
+	if err == nil && svr.tlsEnabled && svr.redirectServer != nil {
+		err = svr.serveAux("HTTP-to-HTTPS redirect", svr.redirectServer,
+			failed)
+	}
+	if err != nil {
+		ln.Close()
+		for _, aux := range svr.auxServers() { aux.Close() }
+		return err
+	}
 	if svr.tlsEnabled {
-		return svr.ListenAndServeTLS(svr.certFile, svr.keyFile)
+		err = svr.Server.ServeTLS(ln, svr.certFile, svr.keyFile)
+	} else {
+		err = svr.Server.Serve(ln)
 	}
-	return svr.ListenAndServe()
+	select {
+		case auxErr := <-failed:
+			return auxErr
+		default:
+			return err
+	}//-- end select
 }//-- end func DefaultServer.ListenAndServe
 
-type handlerMap struct {
-	handlers map[string]http.HandlerFunc
-	mut sync.RWMutex
-}//-- end handlerMap struct
-
-func (hm *handlerMap) Get (key string) http.HandlerFunc {
-	hm.mut.RLock()
-	defer hm.mut.RUnlock()
-	return hm.handlers[key]
-}//-- end func handlerMap.Get
-
-func (hm *handlerMap) loadFile (file *os.File, filename string) {
-	content, _ := ioutil.ReadAll(file)
-	contentType := http.DetectContentType(content)
-	hm.handlers["/" + filename] = func (w http.ResponseWriter,
-			_ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Header().Set("Content-Type", contentType)
-		w.Write(content)
-	}//-- end func
-}//-- end handlerMap.loadFile
-
-func (hm *handlerMap) loadFilesRec (dir *os.File, dirName, prefix string) {
-	if prefix != "" { prefix += "/" }
-	dirName += "/"
-	fileInfos, _ := dir.Readdir(0)//-- ls directory
-	var (
-		file *os.File
-		err error
-		filename string
-	)
-	for _, info := range fileInfos {
-		filename = prefix + info.Name()
-		file, err = os.Open(dirName + filename)
-		if err != nil {
-			log.Fatal(err.Error())
-			continue
-		}
-		if info.IsDir() {
-			hm.loadFilesRec(file, dirName, filename)
-		} else {
-			hm.loadFile(file, filename)
-		}
-		file.Close()
-	}//-- end for range fileInfos
-}//-- end func handlerMap.loadFilesRec
-
-func (hm *handlerMap) LoadFiles (dir *os.File, dirName string) {
-	hm.mut.Lock()
-	defer hm.mut.Unlock()
-	hm.loadFilesRec(dir, dirName, "")
-}//-- end func handlerMap
-
-func (hm *handlerMap) LoadFilesInterval (dirName string,
-		interv time.Duration) {
-	go func() {
-		for {
-			staticDir, err := os.Open(dirName)
-			defer staticDir.Close()
-			if err != nil { log.Fatal(err) }
-			hm.LoadFiles(staticDir, dirName)
-			if interv < 1 { break }
-			time.Sleep(interv)
-		}
+// Binds a secondary listener alongside the main server, and serves it.
+// Should it fail once serving, the main server is closed, and its error
+// sent to failed for Serve to return.
+func (svr *DefaultServer) serveAux (name string, aux *http.Server,
+		failed chan<- error) error {
+	ln, err := net.Listen("tcp", aux.Addr)
+	if err != nil { return fmt.Errorf("%s: %s", name, err.Error()) }
+	log.Printf("Serving %s at %s...\n", name, ln.Addr())
+	go func () {
+		err := aux.Serve(ln)
+		if err == http.ErrServerClosed { return }
+		failed <- fmt.Errorf("%s: %s", name, err.Error())
+		svr.Server.Close()
 	}()
-}//-- end handlerMap.LoadFilesInterval
+	return nil
+}//-- end func DefaultServer.serveAux
 
-func initHandlerMap () (hm handlerMap) {
-	hm.handlers = make(map[string]http.HandlerFunc)
-	return
-}//-- end func initHandlerMap
+func (svr *DefaultServer) auxServers () []*http.Server {
+	servers := make([]*http.Server, 0, 2)
+	if svr.redirectServer != nil {
+		servers = append(servers, svr.redirectServer)
+	}
+	if svr.adminServer != nil { servers = append(servers, svr.adminServer) }
+	return servers
+}//-- end func DefaultServer.auxServers
 
-type cachedStaticServer func (w http.ResponseWriter, r *http.Request)
+func (svr *DefaultServer) Close () error {
+	for _, aux := range svr.auxServers() { aux.Close() }
+	return svr.Server.Close()
+}//-- end func DefaultServer.Close
 
-func makeStaticServer (cfg *ServerConfig) cachedStaticServer {
-	handlers := initHandlerMap()
-	handlers.LoadFilesInterval(cfg.StaticDir,
-		time.Duration(cfg.StaticCacheRefreshSecs) * time.Second)
-	cacheHeader := fmt.Sprintf("max-age=%d", cfg.CacheTimeoutSecs)
-	return func (w http.ResponseWriter, r *http.Request) {
-		log.Printf("serveStatic: %s\n", r.URL.Path)
-		if r.URL.Path == "/" {
-			http.ServeFile(w, r, cfg.StaticDir + "/index.html")
-			return
-		}
-		w.Header().Set("Cache-Control", cacheHeader)
-		handler := handlers.Get(r.URL.Path)
-		if handler == nil {
-			http.Error(w, "not found", http.StatusNotFound)
+func (svr *DefaultServer) Shutdown (ctx context.Context) error {
+	for _, aux := range svr.auxServers() { aux.Shutdown(ctx) }
+	return svr.Server.Shutdown(ctx)
+}//-- end func DefaultServer.Shutdown
+
+// Cache metrics are shared by all mounts; Files counts across them.
+func (svr *DefaultServer) StaticStats () StaticCacheStats {
+	var stats StaticCacheStats
+	for i, mount := range svr.staticMounts {
+		mountStats := mount.files.Stats()
+		if i == 0 {
+			stats = mountStats
 		} else {
-			handler(w, r)
+			stats.Files += mountStats.Files
 		}
-	}//-- end return
-}//-- end func makeStaticServer
+	}//-- end for range staticMounts
+	return stats
+}//-- end func DefaultServer.StaticStats
+
+// Reloads every static mount, returning the total number of files.
+func (svr *DefaultServer) ReloadStatic () (int, error) {
+	total := 0
+	for _, mount := range svr.staticMounts {
+		count, err := mount.files.Reload()
+		if err != nil { return total, err }
+		total += count
+	}//-- end for range staticMounts
+	return total, nil
+}//-- end func DefaultServer.ReloadStatic
+
+// Returns the fingerprinted path of a static file, or urlPath unchanged.
+func (svr *DefaultServer) AssetPath (urlPath string) string {
+	absolute := "/" + strings.TrimPrefix(urlPath, "/")
+	mount, rel := findMount(svr.staticMounts, absolute)
+	if mount == nil { return urlPath }
+	asset := mount.files.AssetPath(rel)
+	if asset == rel { return urlPath }
+	if mount.Prefix != "/" { asset = mount.Prefix + asset }
+	if !strings.HasPrefix(urlPath, "/") { return asset[1:] }
+	return asset
+}//-- end func DefaultServer.AssetPath
 
 func (svr *DefaultServer) ServeStatic (w http.ResponseWriter,
 		r *http.Request) {
@@ -0,0 +1,70 @@
+package webapp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRedirectHandler (t *testing.T) {
+	cases := []struct {
+		tlsAddr, host, uri, want string
+	}{
+		{":443", "example.com", "/a?b=c", "https://example.com/a?b=c"},
+		{":443", "example.com:80", "/", "https://example.com/"},
+		{":8443", "example.com:8080", "/x", "https://example.com:8443/x"},
+		{"127.0.0.1:8443", "[::1]:8080", "/", "https://[::1]:8443/"},
+		{":443", "[::1]", "/", "https://[::1]/"},
+	}//-- end cases
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.uri, nil)
+		req.Host = c.host
+		rec := httptest.NewRecorder()
+		makeRedirectHandler(c.tlsAddr)(rec, req)
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s%s: got status %d", c.host, c.uri, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != c.want {
+			t.Errorf("%s%s: redirected to %q, want %q", c.host, c.uri, got,
+				c.want)
+		}
+	}//-- end for range cases
+}//-- end TestRedirectHandler
+
+func TestHSTSHandler (t *testing.T) {
+	next := http.HandlerFunc(func (w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	for _, subdomains := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		makeHSTSHandler(next, 600, subdomains)(rec,
+			httptest.NewRequest("GET", "/", nil))
+		want := "max-age=600"
+		if subdomains { want += "; includeSubDomains" }
+		if got := rec.Header().Get("Strict-Transport-Security"); got != want {
+			t.Errorf("got HSTS %q, want %q", got, want)
+		}
+		if rec.Body.String() != "ok" { t.Errorf("got body %q", rec.Body.String()) }
+	}//-- end for range subdomains
+}//-- end TestHSTSHandler
+
+func TestServeRedirectError (t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer taken.Close()
+	cfg := &ServerConfig{Port: "127.0.0.1:0", TLSEnabled: true,
+		CertFile: "cert.pem", KeyFile: "key.pem", StaticFS: fstest.MapFS{},
+		RedirectPort: taken.Addr().String()}
+	svr := new(DefaultServer)
+	if err = svr.Init(cfg, &routeTable{Handler: http.NewServeMux()});
+			err != nil {
+		t.Fatal(err)
+	}
+	err = svr.Serve()
+	if err == nil || !strings.Contains(err.Error(), "redirect") {
+		t.Errorf("redirect listener failure not returned: %v", err)
+	}
+}//-- end TestServeRedirectError
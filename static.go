@@ -0,0 +1,541 @@
+package webapp
+
+/**
+ * In-memory cache of the files under ServerConfig.StaticDir (or
+ * StaticFS, e.g. an embed.FS), served by DefaultServer.ServeStatic.
+ * Each file carries a content-hash ETag and its modification time, so
+ * that conditional requests can be answered with 304 Not Modified, and
+ * ranges served from memory (see ranges.go). Files without a
+ * modification time, as in an embed.FS, are validated by ETag alone.
+ * When StaticCacheRefreshSecs is positive, the cache follows changes on
+ * disk file by file: through inotify where available (see
+ * watch_linux.go), otherwise by polling every StaticCacheRefreshSecs.
+ * Memory use is bounded as described in cache.go. Content-Type is chosen
+ * by extension, falling back to sniffing the content, and precompressed
+ * variants are served where accepted (see encoding.go). HTML files
+ * holding resp.NoncePlaceholder are served with the request's CSP nonce
+ * in its place (see security.go).
+ */
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	// local imports
+	"gopkg.in/ollykel/webapp.v0/resp"
+	"gopkg.in/ollykel/webapp.v0/wapputils"
+)
+
+// identifies a version of a file on disk, for change detection
+type fileStamp struct {
+	size int64
+	modTime time.Time
+}//-- end fileStamp struct
+
+// A cached file, ready to be served
+type staticFile struct {
+	content []byte//-- nil while evicted or if streamed
+	contentType string
+	etag string
+	modTime time.Time
+	fsys fs.FS
+	path string//-- within fsys
+	streamed bool
+	hasNonce bool//-- holds resp.NoncePlaceholder
+	cache *staticCache//-- nil if content is always resident
+	elem *list.Element//-- position in cache.resident, if resident
+}//-- end staticFile struct
+
+// Returns the ETag of a cached file, derived from its content
+func contentETag (content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}//-- end func contentETag
+
+func newStaticFile (content []byte, modTime time.Time) *staticFile {
+	return &staticFile{content: content,
+		contentType: http.DetectContentType(content),
+		hasNonce: bytes.Contains(content, []byte(resp.NoncePlaceholder)),
+		etag: contentETag(content),
+		modTime: modTime.UTC().Truncate(time.Second)}
+}//-- end func newStaticFile
+
+// Returns the ETag of a streamed file with a modification time
+func statETag (info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}//-- end func statETag
+
+// Describes a file too large to cache, to be served from its source.
+// Its ETag derives from size and modification time rather than content,
+// unless it has no modification time, in which case it is hashed.
+func newStreamedFile (file io.ReaderAt, info fs.FileInfo) *staticFile {
+	head := make([]byte, 512)
+	n, _ := file.ReadAt(head, 0)
+	etag := statETag(info)
+	if info.ModTime().IsZero() {
+		hash := sha256.New()
+		io.Copy(hash, io.NewSectionReader(file, 0, info.Size()))
+		etag = `"` + hex.EncodeToString(hash.Sum(nil)[:12]) + `"`
+	}
+	return &staticFile{contentType: http.DetectContentType(head[:n]),
+		etag: etag, modTime: info.ModTime().UTC().Truncate(time.Second),
+		streamed: true}
+}//-- end func newStreamedFile
+
+// Tests an If-None-Match header value against etag, using the weak
+// comparison function (RFC 7232, section 2.3.2).
+func etagMatches (header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" ||
+				strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}//-- end for range candidates
+	return false
+}//-- end func etagMatches
+
+// Reports whether the client's cached copy is still current.
+func (file *staticFile) notModified (r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, file.etag)
+	}
+	if file.modTime.IsZero() { return false }
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !file.modTime.After(ims)
+}//-- end func staticFile.notModified
+
+func (file *staticFile) ServeHTTP (w http.ResponseWriter, r *http.Request) {
+	file.serveAs(w, r, file.contentType)
+}//-- end func staticFile.ServeHTTP
+
+// Serves the file under the given Content-Type, e.g. that of the
+// original when file is a precompressed variant.
+func (file *staticFile) serveAs (w http.ResponseWriter, r *http.Request,
+		contentType string) {
+	header := w.Header()
+	header.Set("ETag", file.etag)
+	if !file.modTime.IsZero() {
+		header.Set("Last-Modified", file.modTime.Format(http.TimeFormat))
+	}
+	if file.notModified(r) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if file.streamed {
+		file.serveFromDisk(w, r, contentType)
+		return
+	}
+	content, err := file.cache.content(file)
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	serveRanges(w, r, bytes.NewReader(content), int64(len(content)),
+		contentType, file.etag, file.modTime)
+}//-- end func staticFile.serveAs
+
+// Serves the file with the request's CSP nonce in place of
+// resp.NoncePlaceholder. As the content differs with every response, it
+// carries no validators, and ranges are not served.
+func (file *staticFile) serveWithNonce (w http.ResponseWriter,
+		r *http.Request) {
+	content, err := file.cache.content(file)
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", file.contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(resp.InjectNonce(content, resp.Nonce(r)))
+}//-- end func staticFile.serveWithNonce
+
+func (file *staticFile) serveFromDisk (w http.ResponseWriter,
+		r *http.Request, contentType string) {
+	if file.cache != nil { atomic.AddUint64(&file.cache.streamed, 1) }
+	source, err := file.fsys.Open(file.path)
+	var info fs.FileInfo
+	if err == nil {
+		defer source.Close()
+		info, err = source.Stat()
+	}
+	reader, ok := source.(io.ReaderAt)
+	if err == nil && !ok { err = fmt.Errorf("%s: no random access", file.path) }
+	if err == nil && !info.ModTime().IsZero() && statETag(info) != file.etag {
+		err = fmt.Errorf("%s: changed on disk since loaded", file.path)
+	}
+	if err != nil {
+		log.Print(err.Error())
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	serveRanges(w, r, reader, info.Size(), contentType, file.etag,
+		file.modTime)
+}//-- end func staticFile.serveFromDisk
+
+// Sets Cache-Control for request paths matching Pattern, a path.Match
+// pattern. Patterns without a slash are matched against the base name,
+// e.g. "*.js"; others against the whole path, e.g. "/fonts/*".
+type CacheRule struct {
+	Pattern string `json:"pattern" xml:"pattern" toml:"pattern"`
+	CacheControl string `json:"cachecontrol" xml:"cachecontrol" toml:"cachecontrol"`
+}//-- end CacheRule struct
+
+func (rule *CacheRule) Matches (urlPath string) bool {
+	if !strings.Contains(rule.Pattern, "/") { urlPath = path.Base(urlPath) }
+	matched, _ := path.Match(rule.Pattern, urlPath)
+	return matched
+}//-- end func CacheRule.Matches
+
+// Returns the Cache-Control value for urlPath: that of the first
+// matching rule, otherwise fallback.
+func cacheControlFor (rules []CacheRule, urlPath, fallback string) string {
+	for i := range rules {
+		if rules[i].Matches(urlPath) { return rules[i].CacheControl }
+	}
+	return fallback
+}//-- end func cacheControlFor
+
+type handlerMap struct {
+	handlers map[string]*staticFile
+	stamps map[string]fileStamp
+	fsys fs.FS
+	dirName string//-- on-disk root of fsys, if any, for inotify
+	cache *staticCache
+	fingerprint bool//-- see fingerprint.go
+	aliases map[string]string//-- fingerprinted key -> key
+	manifest map[string]string//-- key -> fingerprinted key
+	mut sync.RWMutex
+	refreshMut sync.Mutex//-- serializes Reload and refreshPath
+}//-- end handlerMap struct
+
+func initHandlerMap () *handlerMap {
+	return &handlerMap{handlers: make(map[string]*staticFile),
+		stamps: make(map[string]fileStamp),
+		aliases: make(map[string]string),
+		manifest: make(map[string]string)}
+}//-- end func initHandlerMap
+
+func (hm *handlerMap) Get (key string) http.Handler {
+	hm.mut.RLock()
+	defer hm.mut.RUnlock()
+	if file, exists := hm.handlers[key]; exists { return file }
+	return nil
+}//-- end func handlerMap.Get
+
+// Converts a path within fsys into a handler key
+func staticKey (rel string) string {
+	return "/" + rel
+}//-- end func staticKey
+
+func (hm *handlerMap) loadFile (file fs.File, filename string,
+		info fs.FileInfo) error {
+	var entry *staticFile
+	reader, randomAccess := file.(io.ReaderAt)
+	if randomAccess && hm.cache.streams(info.Size()) {
+		entry = newStreamedFile(reader, info)
+	} else {
+		content, err := ioutil.ReadAll(file)
+		if err != nil { return err }
+		entry = newStaticFile(content, info.ModTime())
+	}
+	entry.fsys, entry.path = hm.fsys, filename
+	if contentType, known := wapputils.ContentType(filename); known {
+		entry.contentType = contentType
+	}
+	key := staticKey(filename)
+	if old, exists := hm.handlers[key]; exists { hm.cache.forget(old) }
+	hm.handlers[key] = entry
+	hm.addFingerprint(key, entry)
+	entry.cache = hm.cache
+	if hm.cache != nil && !entry.streamed {
+		hm.cache.insert(entry, entry.content)
+	}
+	return nil
+}//-- end handlerMap.loadFile
+
+// Reads a single file, given as a path within fsys, into the map.
+// Caller must hold mut.
+func (hm *handlerMap) loadPath (rel string) error {
+	file, err := hm.fsys.Open(rel)
+	if err != nil { return err }
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil { return err }
+	if info.IsDir() { return fmt.Errorf("%s is a directory", rel) }
+	err = hm.loadFile(file, rel, info)
+	if err != nil { return err }
+	hm.stamps[staticKey(rel)] = fileStamp{info.Size(), info.ModTime()}
+	return nil
+}//-- end func handlerMap.loadPath
+
+// Drops the file at rel, or every file beneath it if rel was a
+// directory. Returns the keys removed. Caller must hold mut.
+func (hm *handlerMap) removePath (rel string) []string {
+	key := staticKey(rel)
+	removed := make([]string, 0, 1)
+	for k := range hm.handlers {
+		if k == key || strings.HasPrefix(k, key + "/") {
+			hm.cache.forget(hm.handlers[k])
+			delete(hm.handlers, k)
+			delete(hm.stamps, k)
+			hm.dropFingerprint(k)
+			removed = append(removed, k)
+		}
+	}//-- end for range hm.handlers
+	return removed
+}//-- end func handlerMap.removePath
+
+// Lists every regular file beneath root, a path within fsys.
+func (hm *handlerMap) scan (root string) map[string]fileStamp {
+	found := make(map[string]fileStamp)
+	if root == "" { root = "." }
+	fs.WalkDir(hm.fsys, root, func (name string, entry fs.DirEntry,
+			err error) error {
+		if err != nil {
+			log.Print(err.Error())
+			return nil
+		}
+		if entry.IsDir() { return nil }
+		info, err := entry.Info()
+		if err != nil { return nil }
+		found[name] = fileStamp{info.Size(), info.ModTime()}
+		return nil
+	})
+	return found
+}//-- end func handlerMap.scan
+
+// Loads every file beneath root, e.g. a newly-created directory.
+func (hm *handlerMap) loadTree (root string) {
+	for rel := range hm.scan(root) {
+		hm.mut.Lock()
+		err := hm.loadPath(rel)
+		hm.mut.Unlock()
+		if err != nil {
+			log.Print(err.Error())
+		} else {
+			logf(LogInfo, "static: added %s\n", staticKey(rel))
+		}
+	}//-- end for range files
+}//-- end func handlerMap.loadTree
+
+// Applies a change reported for a single path: reloads it if it is a
+// file, loads its contents if it is a new directory, and drops it if it
+// no longer exists.
+func (hm *handlerMap) refreshPath (rel string) {
+	hm.refreshMut.Lock()
+	defer hm.refreshMut.Unlock()
+	info, err := fs.Stat(hm.fsys, rel)
+	if err != nil {
+		hm.mut.Lock()
+		removed := hm.removePath(rel)
+		hm.mut.Unlock()
+		for _, key := range removed {
+			logf(LogInfo, "static: removed %s\n", key)
+		}
+		return
+	}
+	if info.IsDir() {
+		hm.loadTree(rel)
+		return
+	}
+	hm.mut.Lock()
+	_, existed := hm.handlers[staticKey(rel)]
+	err = hm.loadPath(rel)
+	hm.mut.Unlock()
+	switch {
+		case err != nil:
+			log.Print(err.Error())
+		case existed:
+			logf(LogInfo, "static: updated %s\n", staticKey(rel))
+		default:
+			logf(LogInfo, "static: added %s\n", staticKey(rel))
+	}//-- end switch
+}//-- end func handlerMap.refreshPath
+
+// Loads every file under dirName, replacing any previous contents.
+func (hm *handlerMap) LoadFiles (dirName string) error {
+	return hm.LoadFS(os.DirFS(dirName), dirName)
+}//-- end func handlerMap.LoadFiles
+
+// Loads every file in fsys, replacing any previous contents. dirName
+// gives fsys's location on disk, or is empty if it has none.
+func (hm *handlerMap) LoadFS (fsys fs.FS, dirName string) error {
+	if _, err := fs.Stat(fsys, "."); err != nil { return err }
+	hm.fsys, hm.dirName = fsys, dirName
+	_, err := hm.Reload()
+	return err
+}//-- end func handlerMap.LoadFS
+
+// Rebuilds the map from scratch, dropping entries for deleted files.
+// Returns the number of files loaded. Refreshes wait until it is done,
+// so that none is lost when the maps are swapped.
+func (hm *handlerMap) Reload () (int, error) {
+	hm.refreshMut.Lock()
+	defer hm.refreshMut.Unlock()
+	if _, err := fs.Stat(hm.fsys, "."); err != nil { return 0, err }
+	fresh := initHandlerMap()
+	fresh.fsys, fresh.dirName, fresh.cache = hm.fsys, hm.dirName, hm.cache
+	fresh.fingerprint = hm.fingerprint
+	for rel := range fresh.scan("") {
+		if err := fresh.loadPath(rel); err != nil { log.Print(err.Error()) }
+	}
+	hm.mut.Lock()
+	defer hm.mut.Unlock()
+	for _, old := range hm.handlers { hm.cache.forget(old) }
+	hm.handlers, hm.stamps = fresh.handlers, fresh.stamps
+	hm.aliases, hm.manifest = fresh.aliases, fresh.manifest
+	return len(hm.handlers), nil
+}//-- end func handlerMap.Reload
+
+func (hm *handlerMap) Stats () StaticCacheStats {
+	stats := StaticCacheStats{}
+	if hm.cache != nil { stats = hm.cache.stats() }
+	hm.mut.RLock()
+	defer hm.mut.RUnlock()
+	stats.Files = len(hm.handlers)
+	return stats
+}//-- end func handlerMap.Stats
+
+// Keeps the map in sync with its source, via inotify unless pollOnly is
+// set or inotify is unavailable (including for sources not on disk), in
+// which case the source is rescanned every interv.
+func (hm *handlerMap) Watch (interv time.Duration, pollOnly bool) {
+	if !pollOnly && hm.dirName != "" {
+		err := hm.watchNotify()
+		if err == nil { return }
+		log.Printf("static: falling back to polling every %s: %s\n", interv,
+			err.Error())
+	}
+	go func() {
+		for {
+			time.Sleep(interv)
+			hm.poll()
+		}
+	}()
+}//-- end func handlerMap.Watch
+
+// Compares the directory against the recorded stamps, refreshing only
+// the files added, changed or removed since the last pass.
+func (hm *handlerMap) poll () {
+	found := hm.scan("")
+	changed := make([]string, 0)
+	hm.mut.RLock()
+	for rel, stamp := range found {
+		if hm.stamps[staticKey(rel)] != stamp { changed = append(changed, rel) }
+	}
+	for key := range hm.stamps {
+		rel := strings.TrimPrefix(key, "/")
+		if _, exists := found[rel]; !exists { changed = append(changed, rel) }
+	}
+	hm.mut.RUnlock()
+	for _, rel := range changed { hm.refreshPath(rel) }
+}//-- end func handlerMap.poll
+
+// Serves the file at key, or its preferred precompressed variant. HTML
+// holding resp.NoncePlaceholder is served uncompressed, with the nonce.
+func (hm *handlerMap) serveFile (w http.ResponseWriter, r *http.Request,
+		file *staticFile, key string) {
+	if file.hasNonce && strings.HasPrefix(file.contentType, "text/html") {
+		file.serveWithNonce(w, r)
+		return
+	}
+	variant, coding, hasVariants := hm.Encoded(key,
+		r.Header.Get("Accept-Encoding"))
+	if hasVariants { w.Header().Add("Vary", "Accept-Encoding") }
+	if variant == nil {
+		file.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Encoding", coding)
+	variant.serveAs(w, r, file.contentType)
+}//-- end func handlerMap.serveFile
+
+type cachedStaticServer func (w http.ResponseWriter, r *http.Request)
+
+// Serves the files of a single mount; request paths are relative to the
+// mount's prefix. Settings are read per request, so they may be reloaded.
+func makeMountServer (mount *staticMount) cachedStaticServer {
+	handlers := mount.files
+	serveIndex := func (w http.ResponseWriter, r *http.Request,
+			settings *StaticMount) bool {
+		index := settings.Index
+		if index == "" { index = "index.html" }
+		indexKey := "/" + strings.TrimPrefix(index, "/")
+		file, _, _ := handlers.Lookup(indexKey)
+		if file == nil { return false }
+		w.Header().Set("Cache-Control", "no-cache")
+		handlers.serveFile(w, r, file, indexKey)
+		return true
+	}//-- end func serveIndex
+	return func (w http.ResponseWriter, r *http.Request) {
+		settings := mount.settings()
+		if hiddenPath(r.URL.Path) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.URL.Path == "/" && serveIndex(w, r, settings) { return }
+		file, key, fingerprinted := handlers.Lookup(r.URL.Path)
+		switch {
+			case fingerprinted:
+				w.Header().Set("Cache-Control", immutableCacheControl)
+				handlers.serveFile(w, r, file, key)
+			case file != nil:
+				cacheHeader := fmt.Sprintf("max-age=%d", settings.CacheTimeoutSecs)
+				w.Header().Set("Cache-Control",
+					cacheControlFor(settings.CacheRules, r.URL.Path, cacheHeader))
+				handlers.serveFile(w, r, file, key)
+			case settings.Listing != "" && serveListing(w, r, settings, handlers):
+			case settings.SPAFallback &&
+					spaRoute(r, settings.SPAExcludePrefixes) &&
+					serveIndex(w, r, settings):
+			default:
+				http.Error(w, "not found", http.StatusNotFound)
+		}//-- end switch
+	}//-- end return
+}//-- end func makeMountServer
+
+// Reports whether any element of urlPath is a dotfile, e.g. ".git" or
+// ".env". These are never served, nor listed (see serveListing), except
+// beneath /.well-known (RFC 8615).
+func hiddenPath (urlPath string) bool {
+	for _, elem := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(elem, ".") && elem != ".well-known" { return true }
+	}//-- end for range elems
+	return false
+}//-- end func hiddenPath
+
+// Reports whether an unmatched request is a page load that the
+// single-page app should route client-side: a GET or HEAD accepting HTML,
+// outside every excluded prefix (e.g. "/api").
+func spaRoute (r *http.Request, excluded []string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") { return false }
+	for _, prefix := range excluded {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix + "/") {
+			return false
+		}
+	}//-- end for range excluded
+	return true
+}//-- end func spaRoute
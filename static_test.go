@@ -0,0 +1,403 @@
+package webapp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticFileConditional (t *testing.T) {
+	modTime := time.Date(2019, 3, 20, 12, 0, 0, 0, time.UTC)
+	file := newStaticFile([]byte("body { color: red; }"), modTime)
+	cases := []struct {
+		method string
+		header http.Header
+		wantCode int
+	}{
+		{"GET", http.Header{}, http.StatusOK},
+		{"GET", http.Header{"If-None-Match": {file.etag}},
+			http.StatusNotModified},
+		{"HEAD", http.Header{"If-None-Match": {`"other", W/` + file.etag}},
+			http.StatusNotModified},
+		{"GET", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+		{"GET", http.Header{"If-Modified-Since":
+			{modTime.Format(http.TimeFormat)}}, http.StatusNotModified},
+		{"GET", http.Header{"If-Modified-Since":
+			{modTime.Add(-time.Hour).Format(http.TimeFormat)}}, http.StatusOK},
+		{"GET", http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since":
+			{modTime.Format(http.TimeFormat)}}, http.StatusOK},
+	}//-- end cases
+	for i, c := range cases {
+		req := httptest.NewRequest(c.method, "/style.css", nil)
+		req.Header = c.header
+		rec := httptest.NewRecorder()
+		file.ServeHTTP(rec, req)
+		if rec.Code != c.wantCode {
+			t.Errorf("case %d: got status %d, want %d", i, rec.Code, c.wantCode)
+		}
+		if rec.Header().Get("ETag") != file.etag {
+			t.Errorf("case %d: missing ETag", i)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("case %d: 304 response has a body", i)
+		}
+	}//-- end for range cases
+}//-- end TestStaticFileConditional
+
+func TestCacheControlFor (t *testing.T) {
+	rules := []CacheRule{
+		{Pattern: "/fonts/*", CacheControl: "max-age=31536000"},
+		{Pattern: "*.html", CacheControl: "no-cache"}}
+	cases := map[string]string{
+		"/fonts/a.woff2": "max-age=31536000",
+		"/docs/index.html": "no-cache",
+		"/app.js": "max-age=60"}
+	for urlPath, want := range cases {
+		if got := cacheControlFor(rules, urlPath, "max-age=60"); got != want {
+			t.Errorf("%s: got %q, want %q", urlPath, got, want)
+		}
+	}//-- end for range cases
+}//-- end TestCacheControlFor
+
+func TestStaticFileRanges (t *testing.T) {
+	file := newStaticFile([]byte("0123456789"), time.Now())
+	cases := []struct {
+		header http.Header
+		wantCode int
+		wantBody string
+	}{
+		{http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "234"},
+		{http.Header{"Range": {"bytes=-3"}}, http.StatusPartialContent, "789"},
+		{http.Header{"Range": {"bytes=7-"}}, http.StatusPartialContent, "789"},
+		{http.Header{"Range": {"bytes=20-30"}},
+			http.StatusRequestedRangeNotSatisfiable, ""},
+		{http.Header{"Range": {"bytes=2-4"}, "If-Range": {`"stale"`}},
+			http.StatusOK, "0123456789"},
+		{http.Header{"Range": {"bytes=2-4"}, "If-Range": {file.etag}},
+			http.StatusPartialContent, "234"},
+		{http.Header{"Range": {"lines=1-2"}}, http.StatusOK, "0123456789"},
+	}//-- end cases
+	for i, c := range cases {
+		req := httptest.NewRequest("GET", "/digits.txt", nil)
+		req.Header = c.header
+		rec := httptest.NewRecorder()
+		file.ServeHTTP(rec, req)
+		if rec.Code != c.wantCode {
+			t.Errorf("case %d: got status %d, want %d", i, rec.Code, c.wantCode)
+		} else if c.wantBody != "" && rec.Body.String() != c.wantBody {
+			t.Errorf("case %d: got body %q, want %q", i, rec.Body.String(),
+				c.wantBody)
+		}
+	}//-- end for range cases
+	req := httptest.NewRequest("GET", "/digits.txt", nil)
+	req.Header.Set("Range", "bytes=0-1,8-9")
+	rec := httptest.NewRecorder()
+	file.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || !strings.HasPrefix(
+			rec.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Errorf("multiple ranges: got %d %s", rec.Code,
+			rec.Header().Get("Content-Type"))
+	}
+}//-- end TestStaticFileRanges
+
+func TestSPARoute (t *testing.T) {
+	excluded := []string{"/api", "/static/"}
+	cases := []struct {
+		method, path, accept string
+		want bool
+	}{
+		{"GET", "/dashboard/settings", "text/html,*/*;q=0.8", true},
+		{"HEAD", "/dashboard", "text/html", true},
+		{"GET", "/dashboard", "application/json", false},
+		{"POST", "/dashboard", "text/html", false},
+		{"GET", "/api", "text/html", false},
+		{"GET", "/api/users", "text/html", false},
+		{"GET", "/apidocs", "text/html", true},
+		{"GET", "/static/missing.js", "text/html", false},
+	}//-- end cases
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("Accept", c.accept)
+		if got := spaRoute(req, excluded); got != c.want {
+			t.Errorf("%s %s (%s): got %v, want %v", c.method, c.path, c.accept,
+				got, c.want)
+		}
+	}//-- end for range cases
+}//-- end TestSPARoute
+
+func TestStaticCacheBudget (t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "aaaaaaaaaa", "b.txt": "bbbbbbbbbb",
+		"c.txt": "cccccccccc", "big.txt": "0123456789012345678901234"}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil { t.Fatal(err) }
+	}
+	hm := initHandlerMap()
+	hm.cache = newStaticCache(20, 25)
+	if err := hm.LoadFiles(dir); err != nil { t.Fatal(err) }
+	stats := hm.Stats()
+	if stats.Files != 4 || stats.ResidentFiles != 2 || stats.ResidentBytes != 20 {
+		t.Fatalf("after load: %+v", stats)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "big.txt"} {
+		rec := httptest.NewRecorder()
+		hm.Get("/" + name).ServeHTTP(rec, httptest.NewRequest("GET",
+			"/" + name, nil))
+		if rec.Body.String() != files[name] {
+			t.Errorf("%s: got body %q", name, rec.Body.String())
+		}
+	}//-- end for range names
+	stats = hm.Stats()
+	//-- which two small files start resident depends on load order
+	if stats.Misses < 1 || stats.Hits + stats.Misses != 3 ||
+			stats.Streamed != 1 ||
+			stats.ResidentBytes > 25 {
+		t.Errorf("after serving: %+v", stats)
+	}
+}//-- end TestStaticCacheBudget
+
+func TestStaticCacheChanged (t *testing.T) {
+	dir := t.TempDir()
+	write := func (name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil { t.Fatal(err) }
+	}//-- end func write
+	write("a.txt", "aaaaaaaaaa")
+	write("b.txt", "bbbbbbbbbb")
+	write("big.txt", "0123456789012345678901234")
+	hm := initHandlerMap()
+	hm.cache = newStaticCache(20, 10)
+	if err := hm.LoadFiles(dir); err != nil { t.Fatal(err) }
+	serve := func (name string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		hm.Get("/" + name).ServeHTTP(rec, httptest.NewRequest("GET",
+			"/" + name, nil))
+		return rec
+	}//-- end func serve
+	serve("a.txt")
+	serve("b.txt")//-- evicts a.txt
+	write("a.txt", "AAAAAAAAAA")
+	write("big.txt", "changed")
+	for _, name := range []string{"a.txt", "big.txt"} {
+		if rec := serve(name); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: changed file served as %d %q, ETag %s", name,
+				rec.Code, rec.Body.String(), rec.Header().Get("ETag"))
+		}
+	}//-- end for range names
+	if _, err := hm.Reload(); err != nil { t.Fatal(err) }
+	if rec := serve("a.txt"); rec.Body.String() != "AAAAAAAAAA" {
+		t.Errorf("after reload: got %d %q", rec.Code, rec.Body.String())
+	}
+}//-- end TestStaticCacheChanged
+
+func TestStaticServerFS (t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte("<!DOCTYPE html><html></html>")},
+		"js/app.js": {Data: []byte("console.log('hi');")}}
+	cfg := &ServerConfig{StaticFS: fsys, CacheTimeoutSecs: 60,
+		SPAFallback: true, SPAExcludePrefixes: []string{"/api"}}
+	serve, _ := makeStaticServer(cfg)
+	cases := []struct {
+		path string
+		wantCode int
+		wantBody string
+	}{
+		{"/", http.StatusOK, "<!DOCTYPE html><html></html>"},
+		{"/js/app.js", http.StatusOK, "console.log('hi');"},
+		{"/dashboard/settings", http.StatusOK, "<!DOCTYPE html><html></html>"},
+		{"/api/users", http.StatusNotFound, ""},
+	}//-- end cases
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept", "text/html")
+		rec := httptest.NewRecorder()
+		serve(rec, req)
+		if rec.Code != c.wantCode {
+			t.Errorf("%s: got status %d, want %d", c.path, rec.Code, c.wantCode)
+		} else if c.wantBody != "" && rec.Body.String() != c.wantBody {
+			t.Errorf("%s: got body %q", c.path, rec.Body.String())
+		}
+	}//-- end for range cases
+}//-- end TestStaticServerFS
+
+func TestStaticFingerprint (t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte("<html></html>")},
+		"js/app.js": {Data: []byte("console.log('hi');")},
+		"js/app.js.gz": {Data: []byte("gzipped")}}
+	cfg := &ServerConfig{StaticFS: fsys, CacheTimeoutSecs: 60,
+		Fingerprint: true}
+	serve, mounts := makeStaticServer(cfg)
+	handlers := mounts[0].files
+	asset := handlers.AssetPath("/js/app.js")
+	if asset == "/js/app.js" || !strings.HasPrefix(asset, "/js/app.") ||
+			!strings.HasSuffix(asset, ".js") {
+		t.Fatalf("unexpected fingerprinted path %q", asset)
+	}
+	if got := handlers.AssetPath("/index.html"); got != "/index.html" {
+		t.Errorf("HTML page fingerprinted as %q", got)
+	}
+	if got := handlers.AssetPath("/js/app.js.gz"); got != "/js/app.js.gz" {
+		t.Errorf("precompressed sibling fingerprinted as %q", got)
+	}
+	cases := map[string]string{
+		asset: immutableCacheControl,
+		"/js/app.js": "max-age=60"}
+	for urlPath, want := range cases {
+		rec := httptest.NewRecorder()
+		serve(rec, httptest.NewRequest("GET", urlPath, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "console.log('hi');" {
+			t.Errorf("%s: got %d %q", urlPath, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Cache-Control"); got != want {
+			t.Errorf("%s: got Cache-Control %q, want %q", urlPath, got, want)
+		}
+	}//-- end for range cases
+}//-- end TestStaticFingerprint
+
+func TestStaticPrecompressed (t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js": {Data: []byte("console.log('hi');")},
+		"app.js.gz": {Data: []byte("gzipped")},
+		"app.js.br": {Data: []byte("brotli")},
+		"style.css": {Data: []byte("body {}")}}
+	serve, _ := makeStaticServer(&ServerConfig{StaticFS: fsys})
+	cases := []struct {
+		path, accept, wantEncoding, wantBody, wantType string
+	}{
+		{"/app.js", "gzip, deflate, br", "br", "brotli",
+			"application/javascript"},
+		{"/app.js", "gzip", "gzip", "gzipped", "application/javascript"},
+		{"/app.js", "br;q=0, gzip;q=0.5", "gzip", "gzipped",
+			"application/javascript"},
+		{"/app.js", "", "", "console.log('hi');", "application/javascript"},
+		{"/style.css", "gzip", "", "body {}",
+			"text/css; charset=utf-8"},
+	}//-- end cases
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept-Encoding", c.accept)
+		rec := httptest.NewRecorder()
+		serve(rec, req)
+		header := rec.Header()
+		if header.Get("Content-Encoding") != c.wantEncoding ||
+				rec.Body.String() != c.wantBody ||
+				header.Get("Content-Type") != c.wantType {
+			t.Errorf("%s (%s): got %q %q %q", c.path, c.accept,
+				header.Get("Content-Encoding"), header.Get("Content-Type"),
+				rec.Body.String())
+		}
+	}//-- end for range cases
+}//-- end TestStaticPrecompressed
+
+func TestStaticMounts (t *testing.T) {
+	cfg := &ServerConfig{
+		StaticFS: fstest.MapFS{"index.html": {Data: []byte("root")},
+			".git/config": {Data: []byte("git")},
+			".well-known/security.txt": {Data: []byte("contact")}},
+		StaticMounts: []StaticMount{
+			{Prefix: "/uploads/", Listing: "json", FS: fstest.MapFS{
+				"a.txt": {Data: []byte("aaa")},
+				"docs/b.txt": {Data: []byte("bbb")},
+				".hidden": {Data: []byte("x")}}},
+			{Prefix: "/assets", Listing: "html", FS: fstest.MapFS{
+				"app.js": {Data: []byte("js")},
+				"img/<logo>.png": {Data: []byte("png")}}}}}
+	if err := cfg.validateMounts(); err != nil { t.Fatal(err) }
+	serve, mounts := makeStaticServer(cfg)
+	if len(mounts) != 3 {
+		t.Fatalf("got %d mounts", len(mounts))
+	}
+	cases := []struct {
+		path string
+		wantCode int
+		wantBody string
+	}{
+		{"/", http.StatusOK, "root"},
+		{"/uploads/a.txt", http.StatusOK, "aaa"},
+		{"/uploads/docs/b.txt", http.StatusOK, "bbb"},
+		{"/uploads", http.StatusOK, `[{"name":"docs","size":0,`},
+		{"/uploads/docs/", http.StatusOK, `[{"name":"b.txt","size":3,`},
+		{"/assets/app.js", http.StatusOK, "js"},
+		{"/assets/img/", http.StatusOK, `href="/assets/img/%3Clogo%3E.png"`},
+		{"/assets/missing.js", http.StatusNotFound, ""},
+		{"/uploadsx/a.txt", http.StatusNotFound, ""},
+		{"/uploads/.hidden", http.StatusNotFound, ""},
+		{"/.git/config", http.StatusNotFound, ""},
+		{"/.well-known/security.txt", http.StatusOK, "contact"},
+	}//-- end cases
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		serve(rec, httptest.NewRequest("GET", c.path, nil))
+		if rec.Code != c.wantCode {
+			t.Errorf("%s: got status %d, want %d", c.path, rec.Code, c.wantCode)
+		} else if !strings.Contains(rec.Body.String(), c.wantBody) {
+			t.Errorf("%s: got body %q", c.path, rec.Body.String())
+		}
+	}//-- end for range cases
+	rec := httptest.NewRecorder()
+	serve(rec, httptest.NewRequest("GET", "/uploads/", nil))
+	if strings.Contains(rec.Body.String(), ".hidden") {
+		t.Errorf("listing includes dotfile: %s", rec.Body.String())
+	}
+	cfg.StaticMounts = append(cfg.StaticMounts,
+		StaticMount{Prefix: "/assets/", Dir: "x"})
+	if cfg.validateMounts() == nil {
+		t.Error("duplicate prefix accepted")
+	}
+}//-- end TestStaticMounts
+
+func TestStaticZeroModTime (t *testing.T) {
+	fsys := fstest.MapFS{//-- no ModTime, as in an embed.FS
+		"a.txt": {Data: []byte("first file")},
+		"b.txt": {Data: []byte("other file")},
+		"c.txt": {Data: []byte("small")}}
+	cfg := &ServerConfig{StaticFS: fsys, StaticStreamThreshold: 8}
+	serve, _ := makeStaticServer(cfg)
+	etags := make(map[string]bool)
+	for _, name := range []string{"/a.txt", "/b.txt", "/c.txt"} {
+		req := httptest.NewRequest("GET", name, nil)
+		req.Header.Set("If-Modified-Since", time.Now().Format(http.TimeFormat))
+		rec := httptest.NewRecorder()
+		serve(rec, req)
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" || etags[etag] {
+			t.Errorf("%s: got status %d, ETag %s", name, rec.Code, etag)
+		}
+		etags[etag] = true
+		if lm := rec.Header().Get("Last-Modified"); lm != "" {
+			t.Errorf("%s: got Last-Modified %s", name, lm)
+		}
+	}//-- end for range names
+}//-- end TestStaticZeroModTime
+
+func TestStaticPoll (t *testing.T) {
+	dir := t.TempDir()
+	write := func (name, content string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil { t.Fatal(err) }
+	}//-- end func write
+	write("a.txt", "one")
+	write("b.txt", "two")
+	hm := initHandlerMap()
+	if err := hm.LoadFiles(dir); err != nil { t.Fatal(err) }
+	write("a.txt", "changed")
+	write("c.txt", "three")
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	hm.poll()
+	if file, _, _ := hm.Lookup("/a.txt"); file == nil ||
+			string(file.content) != "changed" {
+		t.Error("a.txt not updated")
+	}
+	if hm.Get("/b.txt") != nil { t.Error("b.txt not removed") }
+	if hm.Get("/c.txt") == nil { t.Error("c.txt not added") }
+}//-- end TestStaticPoll
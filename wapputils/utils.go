@@ -7,25 +7,42 @@ import (
 	"encoding/json"
 	"html/template"
 	"bytes"
+	"path/filepath"
+	"sync"
+	// local imports
+	"gopkg.in/ollykel/webapp.v0/resp"
 )
 
 var (
 	file_types = map[string]string{
-		"default": "text/plain",
-		"txt": "text/plain",
-		"html": "text/html",
-		"css": "text/css",
+		"default": "text/plain; charset=utf-8",
+		"txt": "text/plain; charset=utf-8",
+		"html": "text/html; charset=utf-8",
+		"css": "text/css; charset=utf-8",
 		"js": "application/javascript",
-		"csv": "text/csv",
+		"mjs": "application/javascript",
+		"map": "application/json",
+		"csv": "text/csv; charset=utf-8",
 		"gif": "image/gif",
 		"ico": "image/x-icon",
 		"jpeg": "image/jpeg",
 		"jpg": "image/jpeg",
 		"json": "application/json",
 		"mpeg": "video/mpeg",
+		"mp3": "audio/mpeg",
+		"mp4": "video/mp4",
+		"webm": "video/webm",
 		"png": "image/png",
+		"webp": "image/webp",
+		"avif": "image/avif",
 		"pdf": "application/pdf",
 		"svg": "image/svg+xml",
+		"wasm": "application/wasm",
+		"woff": "font/woff",
+		"woff2": "font/woff2",
+		"ttf": "font/ttf",
+		"otf": "font/otf",
+		"gz": "application/gzip",
 		"tar": "application/x-tar",
 		"tif": "image/tiff",
 		"tiff": "image/tiff",
@@ -35,35 +52,120 @@ var (
 		"zip": "application/zip"}//-- end file_types
 )
 
-func SetFileType(filename string) string {
-	path := strings.Split(filename, ".")
-	ext := path[len(path) - 1]
+// Looks up the Content-Type for filename by its extension, reporting
+// whether the extension is known.
+func ContentType (filename string) (string, bool) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if ext == "" || ext == "default" { return "", false }
 	fileType, exists := file_types[ext]
-	log.Printf("File type: %s\n", fileType)
+	return fileType, exists
+}//-- end func ContentType
+
+func SetFileType(filename string) string {
+	fileType, exists := ContentType(filename)
 	if !exists { return file_types["default"] }
 	return fileType
 }//-- end func setFileType
 
 func CacheFileServer (filename string, ctx interface{}) http.HandlerFunc {
-	tmp, err := template.ParseFiles(filename)
+	return CacheFileServerFuncs(filename, ctx, nil)
+}//-- end func CacheFileServer
+
+// A template result function, called while rendering, whose result is
+// checked again before each request, e.g. {{asset "/js/app.js"}}
+type lookup struct {
+	fn func (string) string
+	arg, result string
+}//-- end lookup struct
+
+// A template rendered ahead of requests, and again whenever a lookup
+// it made would now give a different result
+type renderedFile struct {
+	tmp *template.Template
+	ctx interface{}
+	funcs template.FuncMap
+	output []byte
+	hasNonce bool
+	lookups []lookup//-- made by the last render
+	mut sync.RWMutex
+}//-- end renderedFile struct
+
+// Executes the template, recording the calls made to functions of the
+// form func (string) string. Caller must hold mut for writing.
+func (file *renderedFile) render () error {
+	var lookups []lookup
+	recording := make(template.FuncMap, len(file.funcs))
+	for name, fn := range file.funcs {
+		lookupFn, ok := fn.(func (string) string)
+		if !ok { continue }
+		recording[name] = func (arg string) string {
+			result := lookupFn(arg)
+			lookups = append(lookups, lookup{lookupFn, arg, result})
+			return result
+		}
+	}//-- end for range funcs
+	content := bytes.Buffer{}
+	err := file.tmp.Funcs(recording).Execute(&content, file.ctx)
+	if err != nil { return err }
+	file.output, file.lookups = content.Bytes(), lookups
+	file.hasNonce = bytes.Contains(file.output,
+		[]byte(resp.NoncePlaceholder))
+	return nil
+}//-- end func renderedFile.render
+
+// Reports whether any lookup would now give a different result. Caller
+// must hold mut.
+func (file *renderedFile) stale () bool {
+	for _, call := range file.lookups {
+		if call.fn(call.arg) != call.result { return true }
+	}
+	return false
+}//-- end func renderedFile.stale
+
+// Returns the current output, rendering it again if stale
+func (file *renderedFile) current () ([]byte, bool) {
+	file.mut.RLock()
+	output, hasNonce, stale := file.output, file.hasNonce, file.stale()
+	file.mut.RUnlock()
+	if !stale { return output, hasNonce }
+	file.mut.Lock()
+	defer file.mut.Unlock()
+	if file.stale() {
+		if err := file.render(); err != nil { log.Print(err.Error()) }
+	}
+	return file.output, file.hasNonce
+}//-- end func renderedFile.current
+
+// Like CacheFileServer, with extra functions available to the template,
+// e.g. Webapp.TemplateFuncs for fingerprinted asset URLs. The page is
+// rendered again whenever a function of the form func (string) string,
+// such as asset, would give a different result, e.g. once a fingerprint
+// changes.
+func CacheFileServerFuncs (filename string, ctx interface{},
+		funcs template.FuncMap) http.HandlerFunc {
+	tmp, err := template.New(filepath.Base(filename)).Funcs(funcs).
+		ParseFiles(filename)
 	if err != nil {
 		log.Print(err.Error())
 		return http.NotFound
 	}
-	content := bytes.Buffer{}
-	err = tmp.Execute(&content, ctx)
-	if err != nil {
+	file := &renderedFile{tmp: tmp, ctx: ctx, funcs: funcs}
+	if err = file.render(); err != nil {
 		log.Print(err.Error())
 		return http.NotFound
 	}
-	output := content.Bytes()
 	fileType := SetFileType(filename)
 	return func(w http.ResponseWriter, r *http.Request) {
 		// log.Printf("cached server: %s\n", r.URL.Path)
+		output, hasNonce := file.current()
 		w.Header().Set("Content-Type", fileType)
+		if hasNonce {
+			w.Write(resp.InjectNonce(output, resp.Nonce(r)))
+			return
+		}
 		w.Write(output)
 	}//-- end return for existing file
-}//-- end func cacheFileServer
+}//-- end func CacheFileServerFuncs
 
 func ServeJSON(w http.ResponseWriter, r *http.Request, item interface{}) {
 	encoder := json.NewEncoder(w)
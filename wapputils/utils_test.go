@@ -0,0 +1,55 @@
+package wapputils
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCacheFileServerFuncs (t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "index.html")
+	err := ioutil.WriteFile(filename,
+		[]byte(`<script src="{{asset "/app.js"}}"></script>`), 0644)
+	if err != nil { t.Fatal(err) }
+	var mut sync.Mutex
+	fingerprint := "0b4dab4813"
+	calls := 0
+	funcs := template.FuncMap{"asset": func (urlPath string) string {
+		mut.Lock()
+		defer mut.Unlock()
+		calls++
+		return "/app." + fingerprint + ".js"
+	}}
+	serve := CacheFileServerFuncs(filename, nil, funcs)
+	get := func () string {
+		rec := httptest.NewRecorder()
+		serve(rec, httptest.NewRequest("GET", "/", nil))
+		if ct := rec.Header().Get("Content-Type");
+				ct != "text/html; charset=utf-8" {
+			t.Errorf("got Content-Type %q", ct)
+		}
+		return rec.Body.String()
+	}//-- end func get
+	want := `<script src="/app.0b4dab4813.js"></script>`
+	if got := get(); got != want { t.Errorf("got %q, want %q", got, want) }
+	mut.Lock()
+	fingerprint = "5e1f00d2c7"
+	mut.Unlock()
+	want = `<script src="/app.5e1f00d2c7.js"></script>`
+	if got := get(); got != want {
+		t.Errorf("after fingerprint change: got %q, want %q", got, want)
+	}
+	mut.Lock()
+	before := calls
+	mut.Unlock()
+	get()
+	mut.Lock()
+	//-- an unchanged page is checked, not rendered again
+	if calls != before + 1 {
+		t.Errorf("%d calls to asset for an unchanged page", calls - before)
+	}
+	mut.Unlock()
+}//-- end TestCacheFileServerFuncs
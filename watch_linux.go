@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+package webapp
+
+/**
+ * inotify-based change detection for the static file cache. Every
+ * directory beneath the static dir gets its own watch; events are
+ * translated into per-file refreshes of the handlerMap.
+ */
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+type inotifyWatcher struct {
+	fd int
+	dirs map[int]string//-- watch descriptor -> dir relative to static dir
+	hm *handlerMap
+	mut sync.Mutex
+}//-- end inotifyWatcher struct
+
+func (hm *handlerMap) watchNotify () error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil { return err }
+	watcher := &inotifyWatcher{fd: fd, dirs: make(map[int]string), hm: hm}
+	if err = watcher.addTree(""); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	go watcher.run()
+	return nil
+}//-- end func handlerMap.watchNotify
+
+// Watches root (relative to the static dir) and every directory below it.
+func (watcher *inotifyWatcher) addTree (root string) error {
+	base := filepath.Join(watcher.hm.dirName, filepath.FromSlash(root))
+	return filepath.Walk(base, func (name string, info os.FileInfo,
+			err error) error {
+		if err != nil || !info.IsDir() { return err }
+		wd, err := syscall.InotifyAddWatch(watcher.fd, name, inotifyMask)
+		if err != nil { return err }
+		rel, _ := filepath.Rel(watcher.hm.dirName, name)
+		if rel == "." { rel = "" }
+		rel = filepath.ToSlash(rel)
+		watcher.mut.Lock()
+		watcher.dirs[wd] = rel
+		watcher.mut.Unlock()
+		return nil
+	})
+}//-- end func inotifyWatcher.addTree
+
+func (watcher *inotifyWatcher) run () {
+	buf := make([]byte, 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1))
+	for {
+		n, err := syscall.Read(watcher.fd, buf)
+		if err == syscall.EINTR { continue }
+		if err != nil || n <= 0 {
+			log.Printf("static: inotify stopped: %v\n", err)
+			return
+		}
+		for offset := 0; offset + syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := buf[nameStart:nameStart + int(event.Len)]
+			name = bytes.TrimRight(name, "\x00")
+			watcher.handle(int(event.Wd), event.Mask, string(name))
+			offset = nameStart + int(event.Len)
+		}//-- end for offset
+	}//-- end for
+}//-- end func inotifyWatcher.run
+
+func (watcher *inotifyWatcher) handle (wd int, mask uint32, name string) {
+	if mask & syscall.IN_Q_OVERFLOW != 0 {
+		log.Print("static: inotify queue overflowed, reloading\n")
+		watcher.hm.Reload()
+		return
+	}
+	watcher.mut.Lock()
+	dir, known := watcher.dirs[wd]
+	if mask & syscall.IN_IGNORED != 0 { delete(watcher.dirs, wd) }
+	watcher.mut.Unlock()
+	if !known || name == "" { return }
+	rel := path.Join(dir, name)
+	if mask & syscall.IN_ISDIR != 0 && mask &
+			(syscall.IN_CREATE | syscall.IN_MOVED_TO) != 0 {
+		if err := watcher.addTree(rel); err != nil { log.Print(err.Error()) }
+		watcher.hm.refreshPath(rel)
+		return
+	}
+	if mask & syscall.IN_CREATE != 0 && watcher.beingWritten(rel) { return }
+	watcher.hm.refreshPath(rel)
+}//-- end func inotifyWatcher.handle
+
+// Reports whether a file just created is a new regular file, whose
+// content is complete only at IN_CLOSE_WRITE. Symlinks, hard links to
+// existing files and special files raise no such event.
+func (watcher *inotifyWatcher) beingWritten (rel string) bool {
+	var stat syscall.Stat_t
+	name := filepath.Join(watcher.hm.dirName, filepath.FromSlash(rel))
+	if err := syscall.Lstat(name, &stat); err != nil { return false }
+	return stat.Mode & syscall.S_IFMT == syscall.S_IFREG && stat.Nlink == 1
+}//-- end func inotifyWatcher.beingWritten
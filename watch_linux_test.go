@@ -0,0 +1,58 @@
+//go:build linux
+// +build linux
+
+package webapp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotifyWatch (t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(target, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hm := initHandlerMap()
+	if err := hm.LoadFiles(dir); err != nil { t.Fatal(err) }
+	if err := hm.watchNotify(); err != nil { t.Skip(err.Error()) }
+	steps := []struct{
+		name string
+		change func () error
+		key string
+		present bool
+	}{
+		{"write", func () error {
+			return ioutil.WriteFile(filepath.Join(dir, "b.txt"),
+				[]byte("two"), 0644)
+		}, "/b.txt", true},
+		{"symlink", func () error {
+			return os.Symlink(target, filepath.Join(dir, "c.txt"))
+		}, "/c.txt", true},
+		{"hard link", func () error {
+			return os.Link(target, filepath.Join(dir, "d.txt"))
+		}, "/d.txt", true},
+		{"new directory", func () error {
+			sub := filepath.Join(dir, "sub")
+			if err := os.Mkdir(sub, 0755); err != nil { return err }
+			return ioutil.WriteFile(filepath.Join(sub, "e.txt"),
+				[]byte("four"), 0644)
+		}, "/sub/e.txt", true},
+		{"remove", func () error {
+			return os.Remove(filepath.Join(dir, "b.txt"))
+		}, "/b.txt", false}}
+	for _, step := range steps {
+		if err := step.change(); err != nil { t.Fatal(err) }
+		deadline := time.Now().Add(2 * time.Second)
+		for (hm.Get(step.key) != nil) != step.present {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: %s never picked up", step.name, step.key)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}//-- end for
+	}//-- end for range steps
+}//-- end TestInotifyWatch
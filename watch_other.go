@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package webapp
+
+import (
+	"errors"
+)
+
+func (hm *handlerMap) watchNotify () error {
+	return errors.New("inotify not supported on this platform")
+}//-- end func handlerMap.watchNotify